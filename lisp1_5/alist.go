@@ -0,0 +1,189 @@
+// Copyright 2020 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// This file contains an alternative evaluator that follows page 13 of
+// the Lisp 1.5 book exactly, including the association list, or a-list,
+// that holds the bindings of variables. The a-list is passed down through
+// every call, so a function sees the bindings of all its callers: the
+// book's dynamic binding. FUNCTION, from the fuller interpreter later in
+// the book, captures the a-list in a FUNARG. Other special forms, such as
+// prog, are not available, nor are macros and fexprs.
+//
+// The evaluator is selected by the AList option to NewContext.
+
+package lisp1_5
+
+// AList returns an Option that sets whether the Context uses the a-list
+// evaluator of the Lisp 1.5 book rather than the default evaluator.
+func AList(on bool) Option {
+	return func(c *Context) {
+		c.alist = on
+	}
+}
+
+// evalA is eval from page 13 of the Lisp 1.5 book.
+//
+//	eval[e;a] = [atom[e] → cdr[assoc[e;a]];
+//	             atom[car[e]] → [eq[car[e];QUOTE] → cadr[e];
+//	                             eq[car[e];COND] → evcon[cdr[e];a];
+//	                             T → apply[car[e];evlis[cdr[e];a];a]];
+//	             T → apply[car[e];evlis[cdr[e];a];a]]
+//
+// Atoms not on the a-list, such as functions made by defn, are global.
+func (c *Context) evalA(e, a *Expr) *Expr {
+	if e == nil {
+		return nil
+	}
+	if atom := e.getAtom(); atom != nil {
+		if atom.typ != tokenAtom && atom.typ != tokenConst {
+			return e // Numbers and the like evaluate to themselves.
+		}
+		if pair := assoc(e, a); pair != nil {
+			return Cdr(pair)
+		}
+		return c.scope[0].vars[atom]
+	}
+	if atom := Car(e).getAtom(); atom != nil {
+		switch atom {
+		case tokQuote:
+			return Car(Cdr(e))
+		case tokCond:
+			return c.evconA(Cdr(e), a)
+		case tokFunction:
+			return atomExpr(&token{typ: tokenFunarg, funarg: &funarg{fn: Car(Cdr(e)), alist: a}})
+		}
+		if specialForms[atom] {
+			errorf("%s is not available in the a-list evaluator", atom)
+		}
+		// The arguments to a macro or fexpr must not be evaluated, so
+		// catch them before evlis does.
+		if lookupElementary(atom) == nil {
+			unsupported(atom.text, c.evalA(Car(e), a))
+		}
+		return c.applyA(atom.text, Car(e), c.evlisA(Cdr(e), a), a)
+	}
+	return c.applyA(top, Car(e), c.evlisA(Cdr(e), a), a)
+}
+
+// applyA is apply from page 13 of the Lisp 1.5 book, with FUNARG added.
+//
+//	apply[fn;x;a] = [atom[fn] → [eq[fn;CAR] → caar[x];
+//	                             ...
+//	                             T → apply[eval[fn;a];x;a]];
+//	                 eq[car[fn];LAMBDA] → eval[caddr[fn];pairlis[cadr[fn];x;a]];
+//	                 eq[car[fn];LABEL] → apply[caddr[fn];x;cons[cons[cadr[fn];caddr[fn]];a]]]
+//
+// The name is for debugging.
+func (c *Context) applyA(name string, fn, x, a *Expr) *Expr {
+	c.okToCall(name, fn, x)
+	defer c.returned()
+	if atom := fn.getAtom(); atom != nil {
+		elem := lookupElementary(atom)
+		if elem == nil && assoc(fn, a) == nil {
+			elem = c.lookupLibrary(atom)
+		}
+		if elem != nil {
+			// Elementaries such as apply and eval, and library functions
+			// such as mapcar, re-enter the evaluator through c.apply and
+			// c.eval, which need the a-list.
+			saved := c.a
+			defer func() { c.a = saved }() // Restore even if an Error unwinds.
+			c.a = a
+			return elem(c, atom, x)
+		}
+		if atom.typ == tokenFunarg {
+			return c.applyA(name, atom.funarg.fn, x, atom.funarg.alist)
+		}
+		if atom.typ == tokenArray {
+			return c.applyArray(atom.array, x)
+		}
+		if atom.typ != tokenAtom {
+			errorf("%s is not a function", fn)
+		}
+		val := c.evalA(fn, a)
+		unsupported(atom.text, val)
+		return c.applyA(name, val, x, a)
+	}
+	switch Car(fn).getAtom() {
+	case tokLambda, tokASCIILambda:
+		c.push(name, x) // For tracebacks only; the bindings are on the a-list.
+		expr := c.evalA(Car(Cdr(Cdr(fn))), pairlis(Car(Cdr(fn)), x, a))
+		c.pop()
+		return expr
+	case tokLabel:
+		return c.applyA(name, Car(Cdr(Cdr(fn))), x, Cons(Cons(Car(Cdr(fn)), Car(Cdr(Cdr(fn)))), a))
+	}
+	unsupported(name, fn)
+	errorf("apply failed: %s", Cons(atomExpr(mkToken(tokenAtom, name)), x))
+	return nil
+}
+
+// unsupported raises an error if fn, the value of the named function,
+// is a macro or fexpr.
+func unsupported(name string, fn *Expr) {
+	switch kind := Car(fn).getAtom(); kind {
+	case tokMacro, tokFexpr:
+		errorf("%s: %ss are not supported by the a-list evaluator", name, kind)
+	}
+}
+
+// evconA is evcon from page 13 of the Lisp 1.5 book.
+//
+//	evcon[c;a] = [eval[caar[c];a] → eval[cadar[c];a];
+//	              T → evcon[cdr[c];a]]
+func (c *Context) evconA(x, a *Expr) *Expr {
+	if x == nil {
+		errorf("no true case in cond")
+	}
+	if c.evalA(Car(Car(x)), a).isTrue() {
+		return c.evalA(Car(Cdr(Car(x))), a)
+	}
+	return c.evconA(Cdr(x), a)
+}
+
+// evlisA is evlis from page 13 of the Lisp 1.5 book.
+//
+//	evlis[m;a] = [null[m] → NIL;
+//	              T → cons[eval[car[m];a];evlis[cdr[m];a]]]
+func (c *Context) evlisA(m, a *Expr) *Expr {
+	if m == nil {
+		return nil
+	}
+	return Cons(c.evalA(Car(m), a), c.evlisA(Cdr(m), a))
+}
+
+// pairlis is as defined in the Lisp 1.5 book. It pairs the variables
+// x with the values y and puts the pairs on the front of the a-list.
+//
+//	pairlis[x;y;a] = [null[x] → a;
+//	                  T → cons[cons[car[x];car[y]];pairlis[cdr[x];cdr[y];a]]]
+func pairlis(x, y, a *Expr) *Expr {
+	if x == nil {
+		if y != nil {
+			errorf("too many arguments: %s", y)
+		}
+		return a
+	}
+	if y == nil {
+		errorf("too few arguments: %s unbound", x)
+	}
+	if Car(x).getAtom() == nil {
+		errorf("no atom")
+	}
+	return Cons(Cons(Car(x), Car(y)), pairlis(Cdr(x), Cdr(y), a))
+}
+
+// assoc is as defined in the Lisp 1.5 book. It returns the first pair on
+// the a-list whose car is x, or nil.
+//
+//	assoc[x;a] = [equal[caar[a];x] → car[a];
+//	              T → assoc[x;cdr[a]]]
+func assoc(x, a *Expr) *Expr {
+	for ; a != nil; a = Cdr(a) {
+		if eq(Car(Car(a)), x) {
+			return Car(a)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// This file contains the implementation of arrays and their elementary
+// (builtin) functions. As in the Lisp 1.5 book, an array is created by
+//
+//	(array name (dim ...) init)
+//
+// and is a function of its subscripts, so (name i j) is the element
+// at row i and column j. Subscripts start at 0.
+
+package lisp1_5
+
+// An array holds its elements in row-major order.
+type array struct {
+	dims  []int
+	elems []*Expr
+}
+
+// maxArray is the largest number of elements an array may have.
+const maxArray = 1 << 24
+
+// newArray returns an array with the given dimensions,
+// with every element set to init.
+func newArray(dims []int, init *Expr) *Expr {
+	n := 1
+	for _, d := range dims {
+		if d < 0 {
+			errorf("negative array dimension %d", d)
+		}
+		// Check each dimension before multiplying, so n cannot overflow.
+		if d > maxArray || d > 0 && n > maxArray/d {
+			errorf("array too large: dimensions %v; limit %d elements", dims, maxArray)
+		}
+		n *= d
+	}
+	a := &array{dims: dims, elems: make([]*Expr, n)}
+	for i := range a.elems {
+		a.elems[i] = init
+	}
+	return atomExpr(&token{typ: tokenArray, array: a})
+}
+
+// offset returns the index in a.elems of the element with the subscripts.
+func (c *Context) offset(a *array, subs []*Expr) int {
+	if len(subs) != len(a.dims) {
+		errorf("array has %d dimensions; have %d subscripts", len(a.dims), len(subs))
+	}
+	off := 0
+	for i, d := range a.dims {
+		sub := c.getInt(subs[i])
+		if sub < 0 || d <= sub {
+			errorf("array subscript %d out of range [0, %d)", sub, d)
+		}
+		off = off*d + sub
+	}
+	return off
+}
+
+// getArray returns the array represented by the expression.
+func getArray(expr *Expr) *array {
+	atom := expr.getAtom()
+	if atom == nil || atom.typ != tokenArray {
+		errorf("expect array; have %s", expr)
+	}
+	return atom.array
+}
+
+// slice returns the elements of the list as a slice.
+func slice(list *Expr) []*Expr {
+	var s []*Expr
+	for ; list != nil; list = Cdr(list) {
+		s = append(s, Car(list))
+	}
+	return s
+}
+
+// arrayForm evaluates (array name (dim ...) init), which binds name to
+// a new array. The name is not evaluated; the dimensions and the initial
+// value, which defaults to nil, are.
+func (c *Context) arrayForm(x *Expr) *Expr {
+	atom := Car(x).getAtom()
+	if atom == nil {
+		errorf("array: %s is not an atom", Car(x))
+	}
+	var dims []int
+	for _, d := range slice(Car(Cdr(x))) {
+		dims = append(dims, c.getInt(c.eval(d)))
+	}
+	if dims == nil {
+		errorf("array: no dimensions for %s", atom)
+	}
+	a := newArray(dims, c.eval(Car(Cdr(Cdr(x)))))
+	c.set(atom, a)
+	return a
+}
+
+// applyArray returns the element of the array with the subscripts x.
+func (c *Context) applyArray(a *array, x *Expr) *Expr {
+	return a.elems[c.offset(a, slice(x))]
+}
+
+// (make-vector n init) returns a one-dimensional array of n elements,
+// each set to init.
+func (c *Context) makeVectorFunc(name *token, expr *Expr) *Expr {
+	return newArray([]int{c.getInt(Car(expr))}, Car(Cdr(expr)))
+}
+
+// (aref array sub ...) returns the element of the array with the subscripts.
+func (c *Context) arefFunc(name *token, expr *Expr) *Expr {
+	return c.applyArray(getArray(Car(expr)), Cdr(expr))
+}
+
+// (aset array sub ... value) sets the element of the array with the
+// subscripts to value, and returns the value.
+func (c *Context) asetFunc(name *token, expr *Expr) *Expr {
+	a := getArray(Car(expr))
+	args := slice(Cdr(expr))
+	if len(args) == 0 {
+		errorf("aset: no value")
+	}
+	value := args[len(args)-1]
+	a.elems[c.offset(a, args[:len(args)-1])] = value
+	return value
+}
+
+// (array-length array) returns the number of elements in the array.
+func (c *Context) arrayLengthFunc(name *token, expr *Expr) *Expr {
+	return intExpr(len(getArray(Car(expr)).elems))
+}
+
+// (arrayp x) reports whether x is an array.
+func (c *Context) arraypFunc(name *token, expr *Expr) *Expr {
+	atom := Car(expr).getAtom()
+	return truthExpr(atom != nil && atom.typ == tokenArray)
+}
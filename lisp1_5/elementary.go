@@ -11,38 +11,157 @@ func evalInit() {
 	if elementary == nil {
 		// Initialized here to avoid initialization loop.
 		elementary = funcMap{
-			tokAdd:   (*Context).addFunc,
-			tokAnd:   (*Context).andFunc,
-			tokApply: (*Context).applyFunc,
-			tokAtom:  (*Context).atomFunc,
-			tokCar:   (*Context).carFunc,
-			tokCdr:   (*Context).cdrFunc,
-			tokCons:  (*Context).consFunc,
-			tokDefn:  (*Context).defnFunc,
-			tokDiv:   (*Context).divFunc,
-			tokEq:    (*Context).eqFunc,
-			tokGe:    (*Context).geFunc,
-			tokGt:    (*Context).gtFunc,
-			tokLe:    (*Context).leFunc,
-			tokList:  (*Context).listFunc,
-			tokLt:    (*Context).ltFunc,
-			tokMul:   (*Context).mulFunc,
-			tokNe:    (*Context).neFunc,
-			tokNull:  (*Context).nullFunc,
-			tokOr:    (*Context).orFunc,
-			tokRem:   (*Context).remFunc,
-			tokSub:   (*Context).subFunc,
+			tokAbs:            (*Context).absFunc,
+			tokAdd:            (*Context).addFunc,
+			tokAnd:            (*Context).andFunc,
+			tokApply:          (*Context).applyFunc,
+			tokAref:           (*Context).arefFunc,
+			tokArrayLength:    (*Context).arrayLengthFunc,
+			tokArrayp:         (*Context).arraypFunc,
+			tokAset:           (*Context).asetFunc,
+			tokAtom:           (*Context).atomFunc,
+			tokAttrib:         (*Context).attribFunc,
+			tokCar:            (*Context).carFunc,
+			tokCdr:            (*Context).cdrFunc,
+			tokClose:          (*Context).closeFunc,
+			tokConcat:         (*Context).concatFunc,
+			tokCons:           (*Context).consFunc,
+			tokDefn:           (*Context).defnFunc,
+			tokDeflist:        (*Context).deflistFunc,
+			tokDenominator:    (*Context).denominatorFunc,
+			tokDiv:            (*Context).divFunc,
+			tokDivide:         (*Context).divideFunc,
+			tokEq:             (*Context).eqFunc,
+			tokEval:           (*Context).evalFunc,
+			tokEvenp:          (*Context).evenpFunc,
+			tokExplode:        (*Context).explodeFunc,
+			tokExpt:           (*Context).exptFunc,
+			tokGcd:            (*Context).gcdFunc,
+			tokGe:             (*Context).geFunc,
+			tokGensym:         (*Context).gensymFunc,
+			tokGet:            (*Context).getFunc,
+			tokGethash:        (*Context).gethashFunc,
+			tokGreater:        (*Context).greaterFunc,
+			tokGreaterEq:      (*Context).greaterEqFunc,
+			tokGt:             (*Context).gtFunc,
+			tokHashCount:      (*Context).hashCountFunc,
+			tokImplode:        (*Context).implodeFunc,
+			tokIsqrt:          (*Context).isqrtFunc,
+			tokLcm:            (*Context).lcmFunc,
+			tokLe:             (*Context).leFunc,
+			tokLeftshift:      (*Context).leftshiftFunc,
+			tokLess:           (*Context).lessFunc,
+			tokLessEq:         (*Context).lessEqFunc,
+			tokList:           (*Context).listFunc,
+			tokLoad:           (*Context).loadFunc,
+			tokLogand:         (*Context).logandFunc,
+			tokLogor:          (*Context).logorFunc,
+			tokLogxor:         (*Context).logxorFunc,
+			tokLt:             (*Context).ltFunc,
+			tokMacroexpand:    (*Context).macroexpandFunc,
+			tokMacroexpand1:   (*Context).macroexpand1Func,
+			tokMakeHashTable:  (*Context).makeHashTableFunc,
+			tokMakeVector:     (*Context).makeVectorFunc,
+			tokMaphash:        (*Context).maphashFunc,
+			tokMax:            (*Context).maxFunc,
+			tokMin:            (*Context).minFunc,
+			tokMinus:          (*Context).minusFunc,
+			tokMinusp:         (*Context).minuspFunc,
+			tokMul:            (*Context).mulFunc,
+			tokNconc:          (*Context).nconcFunc,
+			tokNe:             (*Context).neFunc,
+			tokNegate:         (*Context).negateFunc,
+			tokNotEq:          (*Context).notEqFunc,
+			tokNreverse:       (*Context).nreverseFunc,
+			tokNull:           (*Context).nullFunc,
+			tokNumberp:        (*Context).numberpFunc,
+			tokNumberToString: (*Context).numberToStringFunc,
+			tokNumEq:          (*Context).numEqFunc,
+			tokNumerator:      (*Context).numeratorFunc,
+			tokOddp:           (*Context).oddpFunc,
+			tokOnep:           (*Context).onepFunc,
+			tokOpen:           (*Context).openFunc,
+			tokOr:             (*Context).orFunc,
+			tokPack:           (*Context).implodeFunc,
+			tokPlist:          (*Context).plistFunc,
+			tokPlus:           (*Context).plusFunc,
+			tokPrin1:          (*Context).prin1Func,
+			tokPrinc:          (*Context).princFunc,
+			tokPrint:          (*Context).printFunc,
+			tokProvide:        (*Context).provideFunc,
+			tokPut:            (*Context).putFunc,
+			tokPuthash:        (*Context).puthashFunc,
+			tokPutprop:        (*Context).putFunc,
+			tokQuotient:       (*Context).quotientFunc,
+			tokRead:           (*Context).readFunc,
+			tokReadChar:       (*Context).readCharFunc,
+			tokReadLine:       (*Context).readLineFunc,
+			tokRem:            (*Context).remFunc,
+			tokRemhash:        (*Context).remhashFunc,
+			tokRemprop:        (*Context).rempropFunc,
+			tokRequire:        (*Context).requireFunc,
+			tokRplaca:         (*Context).rplacaFunc,
+			tokRplacd:         (*Context).rplacdFunc,
+			tokSet:            (*Context).setFunc,
+			tokSqrt:           (*Context).sqrtFunc,
+			tokStreamp:        (*Context).streampFunc,
+			tokStringDowncase: (*Context).stringDowncaseFunc,
+			tokStringEq:       (*Context).stringEqFunc,
+			tokStringIndex:    (*Context).stringIndexFunc,
+			tokStringLength:   (*Context).stringLengthFunc,
+			tokStringLt:       (*Context).stringLtFunc,
+			tokStringp:        (*Context).stringpFunc,
+			tokStringToNumber: (*Context).stringToNumberFunc,
+			tokStringToSymbol: (*Context).stringToSymbolFunc,
+			tokStringUpcase:   (*Context).stringUpcaseFunc,
+			tokSub:            (*Context).subFunc,
+			tokSubstring:      (*Context).substringFunc,
+			tokSymbolToString: (*Context).symbolToStringFunc,
+			tokTerpri:         (*Context).terpriFunc,
+			tokTimes:          (*Context).timesFunc,
+			tokUnpack:         (*Context).explodeFunc,
+			tokWriteString:    (*Context).writeStringFunc,
+			tokZerop:          (*Context).zeropFunc,
 		}
 	}
+	libraryInit()
+	osInit()
 	constT = atomExpr(tokT)
 	constF = atomExpr(tokF)
-	constNIL = atomExpr(tokNil)
 }
 
 func (c *Context) applyFunc(name *token, expr *Expr) *Expr {
 	return c.apply("applyFunc", Car(expr), Cdr(expr))
 }
 
+// (eval expr) evaluates the expression. (eval expr env) evaluates it
+// in the environment passed to an fexpr.
+func (c *Context) evalFunc(name *token, expr *Expr) *Expr {
+	env := Car(Cdr(expr))
+	if env == nil {
+		return c.eval(Car(expr))
+	}
+	atom := env.getAtom()
+	if atom == nil || atom.typ != tokenFunarg {
+		errorf("eval: %s is not an environment", env)
+	}
+	saved := c.scope
+	defer func() { c.scope = saved }() // Restore even if an Error unwinds.
+	c.scope = atom.funarg.scope[:len(atom.funarg.scope):len(atom.funarg.scope)]
+	return c.eval(Car(expr))
+}
+
+func (c *Context) macroexpandFunc(name *token, expr *Expr) *Expr {
+	return c.macroexpand(Car(expr))
+}
+
+func (c *Context) macroexpand1Func(name *token, expr *Expr) *Expr {
+	e, _ := c.macroexpand1(Car(expr))
+	return e
+}
+
+// defnFunc defines functions. Each definition is (name fn), or
+// (name fn fexpr) to define an fexpr.
 func (c *Context) defnFunc(name *token, expr *Expr) *Expr {
 	var names []*Expr
 	for expr = Car(expr); expr != nil; expr = Cdr(expr) {
@@ -55,8 +174,15 @@ func (c *Context) defnFunc(name *token, expr *Expr) *Expr {
 		if atom == nil {
 			errorf("malformed defn")
 		}
+		def := Car(Cdr(fn))
+		if kind := Car(Cdr(Cdr(fn))); kind != nil {
+			if kind.getAtom() != tokFexpr {
+				errorf("unknown function kind %s in defn", kind)
+			}
+			def = fexprDef(def)
+		}
 		names = append(names, name)
-		c.set(atom, Car(Cdr(fn)))
+		c.set(atom, def)
 	}
 	var result *Expr
 	for i := len(names) - 1; i >= 0; i-- {
@@ -65,9 +191,37 @@ func (c *Context) defnFunc(name *token, expr *Expr) *Expr {
 	return result
 }
 
+func (c *Context) setFunc(name *token, expr *Expr) *Expr {
+	atom := Car(expr).getAtom()
+	if atom == nil {
+		errorf("set: %s is not an atom", Car(expr))
+	}
+	value := Car(Cdr(expr))
+	if pair := assoc(Car(expr), c.a); pair != nil {
+		pair.cdr = value // A-list evaluator: change the binding in place.
+		return value
+	}
+	c.set(atom, value)
+	return value
+}
+
+// fexprDef turns (lambda args body) into (fexpr args body).
+func fexprDef(fn *Expr) *Expr {
+	switch Car(fn).getAtom() {
+	case tokFexpr:
+		return fn
+	case tokLambda, tokASCIILambda:
+		return Cons(atomExpr(tokFexpr), Cdr(fn))
+	}
+	errorf("fexpr %s is not a lambda", fn)
+	return nil
+}
+
+// (atom x) reports whether x is an atom. As in the book, nil, the empty
+// list, is an atom.
 func (c *Context) atomFunc(name *token, expr *Expr) *Expr {
 	atom := Car(expr)
-	return truthExpr(atom != nil && atom.atom != nil)
+	return truthExpr(atom == nil || atom.atom != nil)
 }
 
 func (c *Context) carFunc(name *token, expr *Expr) *Expr {
@@ -111,8 +265,11 @@ func eq(a, b *Expr) bool {
 	if a.atom == nil || b.atom == nil || a.atom.typ != b.atom.typ {
 		return false
 	}
-	if a.atom.typ == tokenNumber {
-		return a.atom.num.Cmp(b.atom.num) == 0
+	switch a.atom.typ {
+	case tokenNumber:
+		return numCmp(a.atom, b.atom) == 0
+	case tokenString:
+		return a.atom.text == b.atom.text
 	}
 	return a.atom == b.atom
 }
@@ -145,3 +302,62 @@ func truthExpr(t bool) *Expr {
 func (e *Expr) isNumber() bool {
 	return e != nil && e.atom != nil && e.atom.typ == tokenNumber
 }
+
+// Destructive operations. These modify the cons cells of their arguments,
+// so they can make shared or circular structure.
+
+// getCons returns the expression, which must be a cons (a non-empty list).
+func getCons(name *token, expr *Expr) *Expr {
+	if expr == nil || expr.atom != nil {
+		errorf("%s: expect cons; have %s", name, expr)
+	}
+	return expr
+}
+
+// (rplaca x y) replaces the car of x with y and returns x.
+func (c *Context) rplacaFunc(name *token, expr *Expr) *Expr {
+	x := getCons(name, Car(expr))
+	x.car = Car(Cdr(expr))
+	return x
+}
+
+// (rplacd x y) replaces the cdr of x with y and returns x.
+func (c *Context) rplacdFunc(name *token, expr *Expr) *Expr {
+	x := getCons(name, Car(expr))
+	x.cdr = Car(Cdr(expr))
+	return x
+}
+
+// (nconc l...) joins the lists by changing the last cdr of each
+// to point to the next, and returns the result.
+func (c *Context) nconcFunc(name *token, expr *Expr) *Expr {
+	var result, last *Expr
+	for ; expr != nil; expr = Cdr(expr) {
+		l := Car(expr)
+		if l == nil {
+			continue
+		}
+		if last == nil {
+			result = l
+		} else {
+			last.cdr = l
+		}
+		if Cdr(expr) == nil {
+			break // The last argument need not be a list.
+		}
+		for last = getCons(name, l); last.cdr != nil && last.cdr.atom == nil; last = last.cdr {
+		}
+	}
+	return result
+}
+
+// (nreverse l) reverses the list in place and returns it.
+func (c *Context) nreverseFunc(name *token, expr *Expr) *Expr {
+	var result *Expr
+	for l := Car(expr); l != nil; {
+		next := getCons(name, l).cdr
+		l.cdr = result
+		result, l = l, next
+	}
+	return result
+}
@@ -6,48 +6,109 @@ package lisp1_5 // import "robpike.io/lisp/lisp1_5"
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"time"
 )
 
 type elemFunc func(*Context, *token, *Expr) *Expr
 type funcMap map[*token]elemFunc
 type frame map[*token]*Expr
 
-// Types used to signal to the outside. Both are returned
+// Types used to signal to the outside. All are returned
 // through panic, which the caller is expected to recover from.
 type (
 	Error string // Error on execution or parse.
 	EOF   string // End of file on input.
+	Exit  int    // Exit requested by the program, with its status.
 )
 
+// Error implements the error interface.
+func (e Error) Error() string {
+	return string(e)
+}
+
 var elementary funcMap
-var constT, constF, constNIL *Expr
+var constT, constF *Expr
 
 // A scope is effectively a stack frame.
 type scope struct {
-	vars frame  // The variables defined in this frame.
-	fn   string // The name of the called function, for tracebacks.
-	args *Expr  // The arguments of the called function, for tracebacks.
+	vars  frame  // The variables defined in this frame.
+	fn    string // The name of the called function, for tracebacks.
+	args  *Expr  // The arguments of the called function, for tracebacks.
+	fexpr bool   // Whether the called function is an fexpr, for tracebacks.
 }
 
 // A Context holds the state of an interpreter.
 type Context struct {
-	scope         []*scope // The stack of call frames.
-	stackDepth    int      // Current stack depth.
-	maxStackDepth int      // Stack limit.
+	scope         []*scope                  // The stack of call frames.
+	stackDepth    int                       // Current stack depth.
+	maxStackDepth int                       // Stack limit.
+	macroCache    map[*Expr]map[*Expr]*Expr // Macro expansions by definition and call form; nil if not caching.
+	alist         bool                      // Whether to use the a-list evaluator.
+	a             *Expr                     // The current a-list, for elementaries that call eval or apply.
+	input         *Parser                   // The source for read; nil means standard input.
+	output        io.Writer                 // The destination for print and its relatives.
+	libPath       []string                  // The directories require searches for modules.
+	modules       map[string]bool           // The modules loaded or provided.
+	plists        map[*token]*Expr          // Property lists: (indicator value indicator value ...).
+	floatPrec     uint                      // The precision, in bits, of floating-point numbers.
+	gensymCount   int                       // The number of atoms made by gensym.
+	noPrelude     bool                      // Whether to skip loading the prelude.
+	osEnabled     bool                      // Whether the operating system functions are available.
+	args          []string                  // The arguments returned by the args function.
+	start         time.Time                 // When the Context was made, for the elapsed function.
 }
 
-// NewContext returns a Context ready to execute. The argument specifies
-// the maximum stack depth to allow, with <=0 meaning unlimited.
-func NewContext(depth int) *Context {
+// An Option configures a Context. See NewContext.
+type Option func(*Context)
+
+// MacroCache returns an Option that sets whether the expansion of each
+// macro call is remembered, keyed by the macro's definition and the call
+// form, so the macro runs only once per call site. Caching is faster.
+// Redefining a macro discards its expansions, and so that the cache stays
+// bounded, so does expanding more than maxMacroCache distinct calls.
+func MacroCache(on bool) Option {
+	return func(c *Context) {
+		c.macroCache = nil
+		if on {
+			c.macroCache = make(map[*Expr]map[*Expr]*Expr)
+		}
+	}
+}
+
+// maxMacroCache is the number of expansions cached for each macro.
+const maxMacroCache = 1000
+
+// NewContext returns a Context ready to execute, with the prelude loaded
+// unless the Prelude option says otherwise. The argument specifies
+// the maximum depth of nested calls to allow, with <=0 meaning unlimited;
+// it does not limit the total number of calls. The
+// options, if any, are applied in order.
+func NewContext(depth int, opts ...Option) *Context {
 	evalInit()
 	c := &Context{}
 	c.maxStackDepth = depth
+	c.output = os.Stdout
+	c.libPath = []string{"."}
+	c.modules = make(map[string]bool)
+	c.plists = make(map[*token]*Expr)
+	c.floatPrec = defaultFloatPrec
 	c.push(top, nil) // Global variables go in scope[0].
 	vars := c.scope[0].vars
 	vars[tokT] = constT
 	vars[tokF] = constF
-	vars[tokNil] = constNIL
+	vars[tokNil] = nil
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.input != nil {
+		c.input.lex.prec = c.floatPrec
+	}
+	if !c.noPrelude {
+		c.loadPrelude()
+	}
 	return c
 }
 
@@ -75,6 +136,27 @@ func lookupElementary(name *token) elemFunc {
 	return nil
 }
 
+// lookupLibrary returns the library function tied to the atom, or nil.
+// The operating system functions count as library functions if the
+// Context has them. Unlike an elementary, a library function can be redefined, so it is
+// found only if the atom has no value.
+func (c *Context) lookupLibrary(atom *token) elemFunc {
+	fn := library[atom]
+	if fn == nil && c.osEnabled {
+		fn = osLibrary[atom]
+	}
+	if fn != nil && !c.bound(atom) {
+		return fn
+	}
+	return nil
+}
+
+// bound reports whether the atom has a value on the stack.
+func (c *Context) bound(tok *token) bool {
+	_, ok := c.getScope(tok).vars[tok]
+	return ok
+}
+
 // push pushes an execution frame onto the stack.
 func (c *Context) push(fn string, args *Expr) {
 	c.scope = append(c.scope, &scope{
@@ -114,7 +196,10 @@ func (c *Context) StackTrace() string {
 			continue
 		}
 		s := c.scope[i]
-		if s.fn != top {
+		switch {
+		case s.fexpr:
+			fmt.Fprintf(&b, "\t(%s %s) ; fexpr\n", s.fn, Car(s.args))
+		case s.fn != top:
 			fmt.Fprintf(&b, "\t(%s %s)\n", s.fn, Car(s.args))
 		}
 	}
@@ -122,7 +207,7 @@ func (c *Context) StackTrace() string {
 }
 
 // getScope returns the scope in which the token is set.
-// If it is not set, it returns the innermost (deepest) scope.
+// If it is not set, it returns the global (outermost) scope.
 func (c *Context) getScope(tok *token) *scope {
 	var sc *scope
 	for _, s := range c.scope {
@@ -131,7 +216,7 @@ func (c *Context) getScope(tok *token) *scope {
 		}
 	}
 	if sc == nil {
-		return c.scope[len(c.scope)-1]
+		return c.scope[0]
 	}
 	return sc
 }
@@ -144,7 +229,8 @@ func notConst(tok *token) {
 }
 
 // set binds the atom (token) to the expression. If the atom is already
-// bound anywhere on the stack, the innermost instance is rebound.
+// bound anywhere on the stack, the innermost instance is rebound;
+// otherwise a global is created.
 func (c *Context) set(tok *token, expr *Expr) {
 	notConst(tok)
 	c.getScope(tok).vars[tok] = expr
@@ -156,9 +242,10 @@ func (c *Context) setLocal(tok *token, expr *Expr) {
 	c.scope[len(c.scope)-1].vars[tok] = expr
 }
 
-// returns the bound value of the token. The value of a number is itself.
+// returns the bound value of the token. The value of a number, string,
+// array, or other non-symbol is itself.
 func (c *Context) get(tok *token) *Expr {
-	if tok.typ == tokenNumber {
+	if tok.typ != tokenAtom && tok.typ != tokenConst {
 		return atomExpr(tok)
 	}
 	return c.getScope(tok).vars[tok]
@@ -192,12 +279,59 @@ func (c *Context) Eval(expr *Expr) *Expr {
 	if a := Car(expr).getAtom(); a == tokDefn {
 		return c.apply("defn", Car(expr), Cdr(expr))
 	}
+	if c.alist {
+		return c.evalA(expr, nil)
+	}
 	// General expression, treat as a function invocation by
 	// calling apply((lambda () expr), nil).
 	lambda := Cons(atomExpr(tokLambda), Cons(nil, Cons(expr, nil)))
 	return c.apply(top, lambda, nil)
 }
 
+// specialForms holds the atoms that eval handles itself, passing
+// their arguments unevaluated.
+var specialForms = map[*token]bool{
+	tokArray:           true,
+	tokCond:            true,
+	tokDefmacro:        true,
+	tokFunction:        true,
+	tokGo:              true,
+	tokProg:            true,
+	tokQuasiquote:      true,
+	tokQuote:           true,
+	tokReturn:          true,
+	tokSetq:            true,
+	tokWithOpenFile:    true,
+	tokUnquote:         true,
+	tokUnquoteSplicing: true,
+}
+
+// EvalQuote returns the value of applying fn to args, which are not
+// evaluated. This is EVALQUOTE, the top level of the Lisp 1.5 book,
+// in which the input
+//
+//	cons (A B)
+//
+// means (cons 'A 'B). As in the book, special forms, fexprs, and macros
+// are instead evaluated as the expression (fn . args).
+func (c *Context) EvalQuote(fn, args *Expr) *Expr {
+	name := top
+	if a := fn.getAtom(); a != nil {
+		if specialForms[a] {
+			return c.Eval(Cons(fn, args))
+		}
+		switch Car(c.userFunc(a)).getAtom() {
+		case tokFexpr, tokMacro:
+			return c.Eval(Cons(fn, args))
+		}
+		name = a.text
+	}
+	if c.alist {
+		return c.applyA(name, fn, args, nil)
+	}
+	return c.apply(name, fn, args)
+}
+
 // okToCall verifies the fn is defined and there is room on the stack.
 func (c *Context) okToCall(name string, fn, x *Expr) {
 	if fn == nil {
@@ -212,28 +346,66 @@ func (c *Context) okToCall(name string, fn, x *Expr) {
 	}
 }
 
+// returned undoes the accounting of okToCall when a call completes.
+func (c *Context) returned() {
+	if c.maxStackDepth > 0 {
+		c.stackDepth--
+	}
+}
+
 // apply applies fn to expr. The name is for debugging.
 // This is on page 13 of the Lisp 1.5 book, but without the a-list.
 // We do lexical scoping instead using c.push, c.set, etc.
+// Fn may be an atom, a funarg, a lambda expression, or a label expression.
 func (c *Context) apply(name string, fn, x *Expr) *Expr {
+	if c.alist {
+		return c.applyA(name, fn, x, c.a)
+	}
 	c.okToCall(name, fn, x)
+	defer c.returned()
 	if fn.atom != nil {
 		elem := lookupElementary(fn.atom)
 		if elem != nil {
 			return elem(c, fn.atom, x)
 		}
+		if fn.atom.typ == tokenFunarg {
+			return c.applyFunarg(name, fn.atom.funarg, x)
+		}
+		if fn.atom.typ == tokenArray {
+			return c.applyArray(fn.atom.array, x)
+		}
 		if fn.atom.typ != tokenAtom {
 			errorf("%s is not a function", fn)
 		}
+		if lib := c.lookupLibrary(fn.atom); lib != nil {
+			return lib(c, fn.atom, x)
+		}
 		return c.apply(name, c.eval(fn), x)
 	}
-	if l := Car(fn).getAtom(); l == tokLambda || l == tokASCIILambda {
+	if Car(fn).getAtom() == tokLabel {
+		// (label name (lambda ...)) binds name to the lambda in a new
+		// frame, so the lambda can call itself, and then applies it.
+		label := Car(Cdr(fn))
+		atom := label.getAtom()
+		if atom == nil {
+			errorf("malformed label: %s", fn)
+		}
+		lambda := Car(Cdr(Cdr(fn)))
+		c.push("label", Cons(label, nil))
+		c.setLocal(atom, lambda)
+		expr := c.apply(atom.text, lambda, x)
+		c.pop()
+		return expr
+	}
+	// Fexprs and macros are applied like lambdas; eval arranges their arguments.
+	if l := Car(fn).getAtom(); l == tokLambda || l == tokASCIILambda || l == tokFexpr || l == tokMacro {
 		args := x
 		formals := Car(Cdr(fn))
 		if args.length() != formals.length() {
 			errorf("args mismatch for %s: %s %s", name, formals, args)
 		}
 		c.push(name, args)
+		c.scope[len(c.scope)-1].fexpr = l == tokFexpr
 		for args != nil {
 			param := Car(formals)
 			formals = Cdr(formals)
@@ -254,6 +426,9 @@ func (c *Context) apply(name string, fn, x *Expr) *Expr {
 
 // eval evaluates the expression, as on page 13 of the Lisp 1.5 book.
 func (c *Context) eval(e *Expr) *Expr {
+	if c.alist {
+		return c.evalA(e, c.a)
+	}
 	if e == nil {
 		return nil
 	}
@@ -266,13 +441,276 @@ func (c *Context) eval(e *Expr) *Expr {
 			return Car(Cdr(e))
 		case tokCond:
 			return c.evcon(Cdr(e))
+		case tokProg:
+			return c.prog(Cdr(e))
+		case tokSetq:
+			return c.setq(Cdr(e))
+		case tokFunction:
+			return c.function(Car(Cdr(e)))
+		case tokDefmacro:
+			return c.defmacro(Cdr(e))
+		case tokArray:
+			return c.arrayForm(Cdr(e))
+		case tokWithOpenFile:
+			return c.withOpenFile(Cdr(e))
+		case tokQuasiquote:
+			return c.quasiquote(Car(Cdr(e)), 1)
+		case tokUnquote, tokUnquoteSplicing:
+			errorf("%s outside backquote: %s", atom, e)
+		case tokGo, tokReturn:
+			errorf("%s not at top level of prog: %s", atom, e)
+		}
+		switch fn := c.userFunc(atom); Car(fn).getAtom() {
+		case tokFexpr:
+			return c.applyFexpr(atom.text, fn, Cdr(e))
+		case tokMacro:
+			return c.eval(c.expand(e, fn))
 		}
 		return c.apply(atom.text, Car(e), c.evlis(Cdr(e)))
 	}
+	// A lambda or label expression can be applied directly.
+	switch atom := Car(Car(e)).getAtom(); atom {
+	case tokLambda, tokASCIILambda, tokLabel:
+		return c.apply(atom.text, Car(e), c.evlis(Cdr(e)))
+	}
 	errorf("cannot eval %s", e)
 	return nil
 }
 
+// setq evaluates (setq atom expr), which is (set 'atom expr).
+func (c *Context) setq(x *Expr) *Expr {
+	atom := Car(x).getAtom()
+	if atom == nil {
+		errorf("setq: %s is not an atom", Car(x))
+	}
+	expr := c.eval(Car(Cdr(x)))
+	c.set(atom, expr)
+	return expr
+}
+
+// userFunc returns the value of the atom if it is not an elementary, or nil.
+// Eval uses it to find fexprs and macros.
+func (c *Context) userFunc(atom *token) *Expr {
+	if lookupElementary(atom) != nil {
+		return nil
+	}
+	return c.get(atom)
+}
+
+// applyFexpr applies the fexpr fn to the unevaluated argument list x.
+// As in the Lisp 1.5 book, an fexpr has one or two parameters: the
+// argument list and, if wanted, the environment of the caller, which can
+// be passed to eval.
+func (c *Context) applyFexpr(name string, fn, x *Expr) *Expr {
+	args := Cons(x, nil)
+	if Car(Cdr(fn)).length() == 2 {
+		args = Cons(x, Cons(c.environment(), nil))
+	}
+	return c.apply(name, fn, args)
+}
+
+// defmacro evaluates (defmacro name (args) body), binding name to
+// (macro (args) body). When a call (name ...) is evaluated, the macro is
+// applied to the unevaluated arguments and the result is evaluated in
+// place of the call.
+func (c *Context) defmacro(x *Expr) *Expr {
+	name := Car(x)
+	atom := name.getAtom()
+	if atom == nil || Cdr(Cdr(x)) == nil {
+		errorf("malformed defmacro: %s", x)
+	}
+	if old := c.userFunc(atom); Car(old).getAtom() == tokMacro {
+		delete(c.macroCache, old)
+	}
+	c.set(atom, Cons(atomExpr(tokMacro), Cdr(x)))
+	return name
+}
+
+// expand returns the expansion of the call e of the macro.
+func (c *Context) expand(e, macro *Expr) *Expr {
+	cache := c.macroCache[macro]
+	if x, ok := cache[e]; ok {
+		return x
+	}
+	x := c.apply(Car(e).atom.text, macro, Cdr(e))
+	if c.macroCache != nil {
+		if cache == nil || len(cache) >= maxMacroCache {
+			cache = make(map[*Expr]*Expr)
+			c.macroCache[macro] = cache
+		}
+		cache[e] = x
+	}
+	return x
+}
+
+// macroexpand1 expands e once if it is a macro call. It reports
+// whether an expansion occurred.
+func (c *Context) macroexpand1(e *Expr) (*Expr, bool) {
+	atom := Car(e).getAtom()
+	if atom == nil {
+		return e, false
+	}
+	if fn := c.userFunc(atom); Car(fn).getAtom() == tokMacro {
+		return c.expand(e, fn), true
+	}
+	return e, false
+}
+
+// macroexpand expands e until it is no longer a macro call.
+func (c *Context) macroexpand(e *Expr) *Expr {
+	for expanded := true; expanded; {
+		e, expanded = c.macroexpand1(e)
+	}
+	return e
+}
+
+// quasiquote evaluates the backquoted template x. The parts marked with
+// unquote (comma) are evaluated, and those marked with unquote-splicing
+// (comma-at) are evaluated and spliced into the enclosing list. Depth is the
+// nesting level of backquotes; only unquotes at depth 1 are evaluated.
+func (c *Context) quasiquote(x *Expr, depth int) *Expr {
+	if x == nil || x.atom != nil {
+		return x
+	}
+	switch atom := Car(x).getAtom(); atom {
+	case tokUnquote, tokUnquoteSplicing:
+		if depth > 1 {
+			return Cons(Car(x), Cons(c.quasiquote(Car(Cdr(x)), depth-1), nil))
+		}
+		if atom == tokUnquoteSplicing {
+			errorf(",@ not in list: %s", x)
+		}
+		return c.eval(Car(Cdr(x)))
+	case tokQuasiquote:
+		return Cons(Car(x), Cons(c.quasiquote(Car(Cdr(x)), depth+1), nil))
+	}
+	car := Car(x)
+	if depth == 1 && Car(car).getAtom() == tokUnquoteSplicing {
+		return appendList(c.eval(Car(Cdr(car))), c.quasiquote(Cdr(x), depth))
+	}
+	return Cons(c.quasiquote(car, depth), c.quasiquote(Cdr(x), depth))
+}
+
+// appendList returns a copy of the list a with b attached at the end.
+func appendList(a, b *Expr) *Expr {
+	if a == nil {
+		return b
+	}
+	if a.atom != nil {
+		errorf("append: %s is not a list", a)
+	}
+	return Cons(a.car, appendList(a.cdr, b))
+}
+
+// A funarg is a function closed over the frames in which (function fn)
+// was evaluated. When applied, its free variables are resolved in those
+// frames rather than in the frames of the caller.
+type funarg struct {
+	fn    *Expr
+	scope []*scope
+	alist *Expr // The association list, for the a-list evaluator.
+}
+
+// function evaluates (function fn), returning a FUNARG for fn.
+func (c *Context) function(fn *Expr) *Expr {
+	scope := make([]*scope, len(c.scope))
+	copy(scope, c.scope)
+	return atomExpr(&token{typ: tokenFunarg, funarg: &funarg{fn: fn, scope: scope}})
+}
+
+// environment returns a funarg with no function that holds the current
+// frames. It is the environment passed to an fexpr, printed as #<env>.
+func (c *Context) environment() *Expr {
+	return c.function(nil)
+}
+
+// applyFunarg applies the function of the funarg to x with the stack
+// replaced by the funarg's frames.
+func (c *Context) applyFunarg(name string, f *funarg, x *Expr) *Expr {
+	saved := c.scope
+	defer func() { c.scope = saved }() // Restore even if an Error unwinds.
+	// Limit the capacity so pushes cannot overwrite the funarg's frames.
+	c.scope = f.scope[:len(f.scope):len(f.scope)]
+	return c.apply(name, f.fn, x)
+}
+
+// progAction reports how a statement in a prog transfers control.
+type progAction int
+
+const (
+	progNext   progAction = iota // Continue with the next statement.
+	progGo                       // Jump to a label.
+	progReturn                   // Leave the prog.
+)
+
+// prog evaluates (prog (vars...) stmt... label stmt...), as on page 29 of the
+// Lisp 1.5 book. The program variables are bound to nil in a new frame.
+// Atoms in the body are labels, the targets of (go label). If control runs
+// off the end, the value of the prog is nil.
+func (c *Context) prog(x *Expr) *Expr {
+	vars := Car(x)
+	c.push("prog", Cons(vars, nil))
+	for v := vars; v != nil; v = Cdr(v) {
+		atom := Car(v).getAtom()
+		if atom == nil {
+			errorf("malformed prog variable %s", Car(v))
+		}
+		c.setLocal(atom, nil)
+	}
+	body := Cdr(x)
+	for stmt := body; stmt != nil; {
+		s := Car(stmt)
+		stmt = Cdr(stmt)
+		if s.getAtom() != nil {
+			continue // A label.
+		}
+		expr, action := c.progStmt(s)
+		switch action {
+		case progGo:
+			stmt = progLabel(body, expr)
+		case progReturn:
+			c.pop()
+			return expr
+		}
+	}
+	c.pop()
+	return nil
+}
+
+// progStmt evaluates a statement of a prog. As in the book, go and return
+// are recognized only as statements or as the consequents of a cond that
+// is itself a statement, after macro expansion. Unlike a cond elsewhere, a cond with no true case
+// is not an error; execution continues with the next statement.
+func (c *Context) progStmt(s *Expr) (*Expr, progAction) {
+	s = c.macroexpand(s)
+	switch Car(s).getAtom() {
+	case tokGo:
+		return Car(Cdr(s)), progGo
+	case tokReturn:
+		return c.eval(Car(Cdr(s))), progReturn
+	case tokCond:
+		for x := Cdr(s); x != nil; x = Cdr(x) {
+			if c.eval(Car(Car(x))).isTrue() {
+				return c.progStmt(Car(Cdr(Car(x))))
+			}
+		}
+		return nil, progNext
+	}
+	return c.eval(s), progNext
+}
+
+// progLabel returns the statements of the prog body following the label.
+func progLabel(body, label *Expr) *Expr {
+	atom := label.getAtom()
+	for stmt := body; stmt != nil; stmt = Cdr(stmt) {
+		if atom != nil && eq(Car(stmt), label) {
+			return Cdr(stmt)
+		}
+	}
+	errorf("go: no label %s", label)
+	return nil
+}
+
 // evcon evaluates a cond (sic) expression, as on page 13 of the Lisp 1.5 book.
 func (c *Context) evcon(x *Expr) *Expr {
 	if x == nil {
@@ -5,6 +5,10 @@
 package lisp1_5
 
 import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -203,3 +207,1469 @@ func TestStackTrace(t *testing.T) {
 	c.Eval(p.List())
 	t.Fatal("did not crash")
 }
+
+var progTests = []struct {
+	in  string
+	out string
+}{
+	{"(prog () (return 1))", "1"},
+	{"(prog (x y) (return (list x y)))", "(nil nil)"},
+	{"(prog () (go a) (return 1) a (return 2))", "2"},
+	{"(prog () (cond ((eq 1 2) (return 1))) (return 3))", "3"},
+	{"(prog () (cond ((eq 1 1) (go b))) (return 1) b (return 4))", "4"},
+	{"(prog () (add 1 2))", "nil"},
+}
+
+func TestProg(t *testing.T) {
+	for _, test := range progTests {
+		if got := strEval(test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+func TestStackDepth(t *testing.T) {
+	const prog = `(defn(
+		(down (lambda (n) (cond
+			((eq n 0) 0)
+			(T (down (sub n 1)))
+		)))
+	))`
+	c := NewContext(100)
+	c.Eval(NewParser(strings.NewReader(prog)).List())
+	// The limit is on depth, not on the total number of calls.
+	for i := 0; i < 5; i++ {
+		if got := c.Eval(NewParser(strings.NewReader("(down 30)")).List()).String(); got != "0" {
+			t.Fatalf("(down 30) = %s, expected 0", got)
+		}
+	}
+	// A prog loop may make any number of calls.
+	loop := "(prog (i) (setq i 0) top (down 30) (setq i (add i 1)) (cond ((lt i 1000) (go top))) (return i))"
+	if got := c.Eval(NewParser(strings.NewReader(loop)).List()).String(); got != "1000" {
+		t.Fatalf("loop = %s, expected 1000", got)
+	}
+	// But recursion deeper than the limit is still an error.
+	defer func() {
+		if e, ok := recover().(Error); !ok || e != "stack too deep" {
+			t.Fatalf("(down 200): got error %q, expected stack too deep", e)
+		}
+	}()
+	c.Eval(NewParser(strings.NewReader("(down 200)")).List())
+	t.Fatal("(down 200) did not fail")
+}
+
+// evalAll evaluates the expressions in str in order, returning the
+// printed value of the last one.
+func evalAll(c *Context, str string) string {
+	p := NewParser(strings.NewReader(str))
+	var result *Expr
+	for {
+		switch p.SkipSpace() {
+		case '\n':
+			continue
+		case EofRune:
+			return result.String()
+		}
+		result = c.Eval(p.List())
+	}
+}
+
+var setTests = []struct {
+	in  string
+	out string
+}{
+	{"(setq x 3) x", "3"},
+	{"(set 'x 4) x", "4"},
+	{"(set (car '(y z)) 5) y", "5"},
+	{`(defn ((count (lambda (n) (prog (i)
+			(setq i 0)
+		loop	(cond ((eq n 0) (return i)))
+			(setq i (add i n))
+			(setq n (sub n 1))
+			(go loop)
+		)))))
+		(count 100)`,
+		"5050",
+	},
+	// Setq rebinds the innermost binding, so the global is unchanged.
+	{`(setq n 1)
+		(defn ((f (lambda (n) (setq n 2)))))
+		(f 7)
+		n`,
+		"1",
+	},
+	// With nothing bound, setq creates a global.
+	{`(defn ((g (lambda () (setq m 9)))))
+		(g)
+		m`,
+		"9",
+	},
+}
+
+func TestSet(t *testing.T) {
+	for _, test := range setTests {
+		if got := evalAll(NewContext(0), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+func TestSetConst(t *testing.T) {
+	for _, text := range []string{"(setq T F)", "(set 'nil 1)"} {
+		func() {
+			defer func() {
+				if _, ok := recover().(Error); !ok {
+					t.Errorf("%s: no error", text)
+				}
+			}()
+			strEval(text)
+		}()
+	}
+}
+
+var labelTests = []struct {
+	in  string
+	out string
+}{
+	{"((lambda (x) (add x 1)) 2)", "3"},
+	{"((label fac (lambda (n) (cond ((eq n 0) 1) (T (mul n (fac (sub n 1))))))) 5)", "120"},
+	{"(apply '(label fac (lambda (n) (cond ((eq n 0) 1) (T (mul n (fac (sub n 1))))))) 6)", "720"},
+	{`(defn ((mapcar (lambda (fn list) (cond
+			((null list) nil)
+			(T (cons (fn (car list)) (mapcar fn (cdr list))))
+		)))))
+		(mapcar '(label len (lambda (l) (cond ((null l) 0) (T (add 1 (len (cdr l))))))) '((a) (a b) ()))`,
+		"(1 2 0)",
+	},
+}
+
+func TestLabel(t *testing.T) {
+	for _, test := range labelTests {
+		if got := evalAll(NewContext(0), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+const mapcarDefn = `(defn ((mapcar (lambda (fn list) (cond
+	((null list) nil)
+	(T (cons (fn (car list)) (mapcar fn (cdr list))))
+)))))
+`
+
+var funargTests = []struct {
+	in  string
+	out string
+}{
+	{"(function (lambda (x) x))", "#<funarg (lambda (x) x)>"},
+	{`(defn ((addN (lambda (n) (function (lambda (x) (add x n)))))))
+		(setq add5 (addN 5))
+		(add5 10)`,
+		"15",
+	},
+	{mapcarDefn + `(defn ((addAll (lambda (n l) (mapcar (function (lambda (x) (add x n))) l)))))
+		(addAll 3 '(1 2 3))`,
+		"(4 5 6)",
+	},
+	// Without function, list would be mapcar's variable, not f's.
+	{mapcarDefn + `(defn ((f (lambda (list) (mapcar (function (lambda (x) (cons x list))) '(a b))))))
+		(f '(z))`,
+		"((a . #1=(z)) (b . #1#))",
+	},
+	{mapcarDefn + `(defn ((f (lambda (list) (mapcar '(lambda (x) (cons x list)) '(a b))))))
+		(f '(z))`,
+		"((a a . #1=(b)) (b . #1#))",
+	},
+}
+
+func TestFunarg(t *testing.T) {
+	for _, test := range funargTests {
+		if got := evalAll(NewContext(0), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+// An error in a funarg leaves the stack as it was, not the funarg's.
+func TestFunargError(t *testing.T) {
+	c := NewContext(0)
+	evalAll(c, "(defn ((mk (λ (n) (function (λ (x) (undefined n))))))) (setq f (mk 1))")
+	c.push("test", nil)
+	c.setLocal(mkAtom("mine"), constT)
+	func() {
+		defer func() { recover() }()
+		evalAll(c, "(f 2)")
+	}()
+	if !c.bound(mkAtom("mine")) {
+		t.Error("error in funarg did not restore the stack")
+	}
+}
+
+var plistTests = []struct {
+	in  string
+	out string
+}{
+	{"(get 'ann 'color)", "nil"},
+	{"(put 'ann 'color 'red) (get 'ann 'color)", "red"},
+	{"(putprop 'ann 'color 'blue) (get 'ann 'color)", "blue"},
+	{"(put 'ann 'x 1) (put 'ann 'y 2) (plist 'ann)", "(y 2 x 1)"},
+	{"(put 'ann 'x 1) (remprop 'ann 'x)", "T"},
+	{"(put 'ann 'x 1) (remprop 'ann 'x) (remprop 'ann 'x)", "F"},
+	{"(deflist '((ann mary) (bob john)) 'mother)", "(ann bob)"},
+	{"(deflist '((ann mary)) 'mother) (get 'ann 'mother)", "mary"},
+	{"(put 'ann 'a 1) (attrib 'ann '(b 2)) (list (plist 'ann) (get 'ann 'b))", "((a 1 b 2) 2)"},
+}
+
+func TestPlist(t *testing.T) {
+	for _, test := range plistTests {
+		if got := evalAll(NewContext(0), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+	// Each Context has its own property lists.
+	c1, c2 := NewContext(0), NewContext(0)
+	evalAll(c1, "(put 'ann 'color 'red)")
+	if got := evalAll(c2, "(get 'ann 'color)"); got != "nil" {
+		t.Errorf("property visible in another Context: %s", got)
+	}
+}
+
+const myifDefn = `(defn (
+	(myif (lambda (l e) (cond
+		((eval (car l) e) (eval (cadr l) e))
+		(T (eval (caddr l) e))
+	)) fexpr)
+))
+`
+
+var fexprTests = []struct {
+	in  string
+	out string
+}{
+	{"(defn ((myquote (lambda (l) (car l)) fexpr))) (myquote (a b))", "(a b)"},
+	{"(defn ((myquote (fexpr (l) l)))) (myquote a b c)", "(a b c)"},
+	{"(defn ((f (lambda (l) (car l)) fexpr))) f", "(fexpr (l) (car l))"},
+	{myifDefn + "(myif (eq 1 1) 'yes (car 'oops))", "yes"},
+	// The environment resolves l to g's variable, not myif's.
+	{myifDefn + "(defn ((g (lambda (l) (myif (eq l 0) 'zero 'nonzero))))) (list (g 0) (g 1))", "(zero nonzero)"},
+	{"(eval '(add 1 2))", "3"},
+}
+
+func TestFexpr(t *testing.T) {
+	for _, test := range fexprTests {
+		if got := evalAll(NewContext(0), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+// An error in eval with an environment leaves the stack as it was.
+func TestEvalEnvError(t *testing.T) {
+	c := NewContext(0)
+	evalAll(c, "(defn ((env (λ (l env) env) fexpr))) (setq e (env))")
+	c.push("test", nil)
+	c.setLocal(mkAtom("mine"), constT)
+	func() {
+		defer func() { recover() }()
+		evalAll(c, "(eval '(undefined) e)")
+	}()
+	if !c.bound(mkAtom("mine")) {
+		t.Error("error in eval did not restore the stack")
+	}
+}
+
+func TestFexprStackTrace(t *testing.T) {
+	c := NewContext(0)
+	evalAll(c, "(defn ((bad (lambda (l) (div 1 0)) fexpr)))")
+	defer func() {
+		if _, ok := recover().(Error); !ok {
+			t.Fatal("no error")
+		}
+		const expect = "stack: (bad (x y)) ; fexpr"
+		stack := c.StackTrace()
+		if strings.Join(strings.Fields(stack), " ") != expect {
+			t.Fatal(stack)
+		}
+	}()
+	evalAll(c, "(bad x y)")
+	t.Fatal("did not crash")
+}
+
+const macroDefs = `
+(defmacro my-when (test body) (list 'cond (list test body) '(T nil)))
+(defmacro twice (x) (list 'my-when 'T (list 'add x x)))
+`
+
+var macroTests = []struct {
+	in  string
+	out string
+}{
+	{macroDefs, "twice"},
+	{macroDefs + "(my-when (eq 1 1) 'yes)", "yes"},
+	{macroDefs + "(my-when (eq 1 2) 'yes)", "nil"},
+	{macroDefs + "(twice 4)", "8"},
+	{macroDefs + "my-when", "(macro (test body) (list 'cond (list test body) '(T nil)))"},
+	{macroDefs + "(macroexpand-1 '(twice 4))", "(my-when T (add 4 4))"},
+	{macroDefs + "(macroexpand '(twice 4))", "(cond (T (add 4 4)) (T nil))"},
+	{macroDefs + "(macroexpand '(add 1 2))", "(add 1 2)"},
+	// Macros are expanded before go and return are recognized in a prog.
+	{macroDefs + "(prog () (my-when T (go a)) (return 1) a (return 2))", "2"},
+}
+
+func TestMacro(t *testing.T) {
+	for _, cache := range []bool{false, true} {
+		for _, test := range macroTests {
+			if got := evalAll(NewContext(0, MacroCache(cache)), test.in); got != test.out {
+				t.Errorf("cache=%t: %s = %s, expected %s", cache, test.in, got, test.out)
+			}
+		}
+	}
+}
+
+func TestMacroCache(t *testing.T) {
+	const prog = `
+		(defmacro m () (prog () (setq count (add count 1)) (return count)))
+		(setq count 0)
+		(defn ((f (lambda () (m)))))
+		(f) (f) (f)
+	`
+	if got := evalAll(NewContext(0), prog); got != "3" {
+		t.Errorf("uncached: got %s, expected 3", got)
+	}
+	c := NewContext(0, MacroCache(true))
+	if got := evalAll(c, prog); got != "1" {
+		t.Errorf("cached: got %s, expected 1", got)
+	}
+	// Redefining the macro discards the cached expansions.
+	if got := evalAll(c, "(defmacro m () ''new) (f)"); got != "new" {
+		t.Errorf("after redefinition: got %s, expected new", got)
+	}
+	// The cache is bounded.
+	for i := 0; i < 2*maxMacroCache; i++ {
+		evalAll(c, "(m)")
+	}
+	if n := len(c.macroCache[c.get(mkAtom("m"))]); n > maxMacroCache {
+		t.Errorf("%d cached expansions; limit is %d", n, maxMacroCache)
+	}
+}
+
+var nilTests = []struct {
+	in  string
+	out string
+}{
+	{"(null nil)", "T"},
+	{"(null '())", "T"},
+	{"(eq nil '())", "T"},
+	{"(atom nil)", "T"},
+	{"(null (car '(nil)))", "T"},
+	{"(cons 'a nil)", "(a)"},
+	{"'(a . nil)", "(a)"},
+	{"(atom '())", "T"},
+	{"(eq (cdr '(a)) 'nil)", "T"},
+}
+
+func TestNil(t *testing.T) {
+	for _, test := range nilTests {
+		if got := strEval(test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+var backquoteTests = []struct {
+	in  string
+	out string
+}{
+	{"`(a b)", "(a b)"},
+	{"(setq x 1) `(a ,x)", "(a 1)"},
+	{"(setq x '(1 2)) `(a ,@x b)", "(a 1 2 b)"},
+	{"(setq x '(1 2)) `(a ,@x)", "(a 1 2)"},
+	{"(setq x 3) `(a . ,x)", "(a . 3)"},
+	{"(setq x 3) `(a `(b ,(c ,x)))", "(a `(b ,(c 3)))"},
+	{"(defmacro inc (v) `(setq ,v (add ,v 1))) (setq n 5) (inc n) n", "6"},
+	{"(defn ((addN (lambda (n) `(lambda (a) (add ,n a)))))) (addN 5)", "(lambda (a) (add 5 a))"},
+}
+
+func TestBackquote(t *testing.T) {
+	for _, test := range backquoteTests {
+		if got := evalAll(NewContext(0), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+var evalQuoteTests = []struct {
+	fn   string
+	args string
+	out  string
+}{
+	{"cons", "(A B)", "(A . B)"},
+	{"car", "((A B))", "A"},
+	{"(lambda (x y) (cons y x))", "(A B)", "(B . A)"},
+	{"cond", "(((eq 1 2) 'no) (T 'yes))", "yes"},
+	{"quote", "(A)", "A"},
+	{"defn", "(((second (lambda (l) (car (cdr l))))))", "(second)"},
+}
+
+func TestEvalQuote(t *testing.T) {
+	c := NewContext(0)
+	for _, test := range evalQuoteTests {
+		fn := NewParser(strings.NewReader(test.fn)).List()
+		args := NewParser(strings.NewReader(test.args)).List()
+		if got := c.EvalQuote(fn, args).String(); got != test.out {
+			t.Errorf("%s %s = %s, expected %s", test.fn, test.args, got, test.out)
+		}
+	}
+	// The definition above is now available.
+	if got := evalAll(c, "(second '(A B C))"); got != "B" {
+		t.Errorf("(second '(A B C)) = %s, expected B", got)
+	}
+}
+
+func TestAListExamples(t *testing.T) {
+	for _, test := range examples {
+		c := NewContext(0, AList(true))
+		if got := evalAll(c, test.fn); got != test.name {
+			t.Errorf("%s = %s, expected %s", test.fn, got, test.name)
+		}
+		if got := evalAll(c, test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+var alistTests = []struct {
+	in  string
+	out string
+}{
+	{"((lambda (x y) (cons y x)) 'a 'b)", "(b . a)"},
+	{"((label fac (lambda (n) (cond ((eq n 0) 1) (T (mul n (fac (sub n 1))))))) 5)", "120"},
+	{"(apply '(lambda (x) (add x 1)) 2)", "3"},
+	// Dynamic binding: g sees f's x on the a-list.
+	{"(defn ((f (lambda (x) (g))) (g (lambda () x)))) (f 5)", "5"},
+	// A funarg holds the a-list in effect when it was made.
+	{`(defn ((addN (lambda (n) (function (lambda (x) (add x n)))))))
+		(defn ((call (lambda (fn n) (fn 10)))))
+		(call (addN 5) 100)`,
+		"15",
+	},
+	// Library functions see the a-list of their caller.
+	{"(defn ((f (lambda (n) (mapcar '(lambda (x) (add x n)) '(1 2)))))) (f 10)", "(11 12)"},
+	// Set changes the binding on the a-list.
+	{"(defn ((h (lambda (x) ((lambda (y) x) (set 'x 2)))))) (h 1)", "2"},
+}
+
+// An error in an elementary called by the a-list evaluator leaves the
+// a-list as it was.
+func TestAListError(t *testing.T) {
+	c := NewContext(0, AList(true))
+	func() {
+		defer func() { recover() }()
+		evalAll(c, "((lambda (x) (mapcar '(lambda (y) (undefined y)) '(1))) 5)")
+	}()
+	if c.a != nil {
+		t.Errorf("a-list after error: %s", c.a)
+	}
+}
+
+func TestAList(t *testing.T) {
+	for _, test := range alistTests {
+		if got := evalAll(NewContext(0, AList(true)), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+func TestAListProg(t *testing.T) {
+	defer func() {
+		if _, ok := recover().(Error); !ok {
+			t.Fatal("no error")
+		}
+	}()
+	evalAll(NewContext(0, AList(true)), "(prog () (return 1))")
+	t.Fatal("prog did not fail")
+}
+
+// Macros and fexprs, including those in the prelude, are errors in the
+// a-list evaluator, whether called directly or through apply.
+func TestAListMacro(t *testing.T) {
+	for _, test := range []string{
+		"(let ((x 1)) x)",
+		"((lambda (n) (when T n)) 1)",
+		"(apply 'let '(((x 1)) x))",
+		"(defn ((quoted (lambda (x) x) fexpr))) (quoted a b)",
+	} {
+		func() {
+			defer func() {
+				e, ok := recover().(Error)
+				if !ok || !strings.Contains(string(e), "not supported by the a-list evaluator") {
+					t.Errorf("%s: got error %q", test, e)
+				}
+			}()
+			evalAll(NewContext(0, AList(true)), test)
+		}()
+	}
+}
+
+var floatTests = []struct {
+	in  string
+	out string
+}{
+	{"3.14", "3.14"},
+	{"1e3", "1000.0"},
+	{"-2.5e-3", "-0.0025"},
+	{"(add 1.5 2.25)", "3.75"},
+	{"(add 1 2.0)", "3.0"},
+	{"(sub 1 0.5)", "0.5"},
+	{"(mul 2 1.5)", "3.0"},
+	{"(div 1 4.0)", "0.25"},
+	{"(div 1 3.0)", "0.3333333333333333"},
+	{"(rem 7.5 2)", "1.5"},
+	{"(rem -7.5 2)", "-1.5"},
+	{"(quotient 7.5 2)", "3.0"},
+	{"(quotient -7.5 2)", "-3.0"},
+	{"(div 7 2)", "7/2"},
+	{"(quotient 7 2)", "3"},
+	{"(lt 1 1.5)", "T"},
+	{"(ge 2.0 2)", "T"},
+	{"(eq 2 2.0)", "T"},
+	{"(ne 0.1 0.2)", "T"},
+}
+
+func TestFloat(t *testing.T) {
+	for _, test := range floatTests {
+		if got := strEval(test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+// Each Context has its own precision, which applies to the floats it
+// computes and reads.
+func TestFloatPrecision(t *testing.T) {
+	for _, test := range []struct {
+		prec uint
+		out  string
+	}{
+		{0, "(0.3333333333333333 0.30000000000000004)"},
+		{24, "(0.33333334 0.3)"},
+		{100, "(0.3333333333333333333333333333335 0.3)"},
+	} {
+		p := NewParser(strings.NewReader("0.1"))
+		c := NewContext(0, Input(p), FloatPrecision(test.prec))
+		if got := evalAll(c, "(list (div 1 3.0) (mul (read) 3))"); got != test.out {
+			t.Errorf("precision %d: got %s, expected %s", test.prec, got, test.out)
+		}
+	}
+	// Comparisons are exact, whatever the precision.
+	for _, test := range []struct {
+		in  string
+		out string
+	}{
+		{"(eq 0.1 1/10)", "F"},
+		{"(lt 1/10 0.1)", "T"},
+		{"(eq 0.5 1/2)", "T"},
+		{"(eq 9007199254740993 9007199254740992.0)", "F"},
+		{"(eq 1e400 (expt 10 400))", "F"},
+	} {
+		if got := strEval(test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+func TestFloatDivZero(t *testing.T) {
+	defer func() {
+		if _, ok := recover().(Error); !ok {
+			t.Fatal("no error")
+		}
+	}()
+	strEval("(div 1.0 0)")
+	t.Fatal("division by zero did not fail")
+}
+
+func TestFloatOverflow(t *testing.T) {
+	for _, test := range []string{
+		"(mul 1e400000000 1e400000000)",
+		"(setq big (mul 1e400000000 1e400000000)) (sub big big)",
+		"(expt 1e300000000 1000)",
+		"(sqrt (expt 10.0 1000000000))",
+	} {
+		func() {
+			defer func() {
+				if _, ok := recover().(Error); !ok {
+					t.Errorf("%s: no error", test)
+				}
+			}()
+			evalAll(NewContext(0), test)
+		}()
+	}
+	// Operations that would give NaN are errors, not crashes.
+	inf := atomExpr(&token{typ: tokenNumber, flt: new(big.Float).SetInf(false)})
+	defer func() {
+		if _, ok := recover().(Error); !ok {
+			t.Error("Inf - Inf: no error")
+		}
+	}()
+	NewContext(0).subFunc(tokSub, Cons(inf, Cons(inf, nil)))
+}
+
+// Exponents and shifts that would exhaust memory are errors.
+func TestMathLimits(t *testing.T) {
+	for _, test := range []string{
+		"(expt 2 100000000)",
+		"(expt 1/3 100000000)",
+		"(expt 10 100000000000000000000)",
+		"(expt 2.0 1e20)",
+		"(expt -2 0.5)",
+		"(expt 0 -0.5)",
+		"(leftshift 1 10000000000)",
+	} {
+		func() {
+			defer func() {
+				if _, ok := recover().(Error); !ok {
+					t.Errorf("%s: no error", test)
+				}
+			}()
+			strEval(test)
+		}()
+	}
+	for _, test := range []struct {
+		in  string
+		out string
+	}{
+		{"(expt 1 100000000000000000000)", "1"},
+		{"(expt -1 100000000000000000001)", "-1"},
+		{"(leftshift 0 10000000000)", "0"},
+	} {
+		if got := strEval(test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+// A fractional power is computed at the floating-point precision.
+func TestExptPrecision(t *testing.T) {
+	c := NewContext(0, FloatPrecision(200))
+	if got, want := evalAll(c, "(expt 2 0.5)"), evalAll(c, "(sqrt 2)"); got != want {
+		t.Errorf("(expt 2 0.5) = %s, expected %s", got, want)
+	}
+}
+
+var ratTests = []struct {
+	in  string
+	out string
+}{
+	{"1/3", "1/3"},
+	{"2/4", "1/2"},
+	{"4/2", "2"},
+	{"-3/6", "-1/2"},
+	{"(div 1 3)", "1/3"},
+	{"(div 6 3)", "2"},
+	{"(quotient 7 2)", "3"},
+	{"(quotient -7 2)", "-3"},
+	{"(quotient 7/2 1/2)", "7"},
+	{"(quotient 7/2 2/3)", "5"},
+	{"(add 1/3 2/3)", "1"},
+	{"(add 1/3 1)", "4/3"},
+	{"(sub 1/2 1/3)", "1/6"},
+	{"(mul 2/3 3/4)", "1/2"},
+	{"(div 1/2 1/4)", "2"},
+	{"(rem 7/2 1)", "1/2"},
+	{"(rem -7/2 1)", "-1/2"},
+	{"(add 1/2 0.25)", "0.75"},
+	{"(mul 1/3 3.0)", "1.0"},
+	{"(lt 1/3 1/2)", "T"},
+	{"(gt 1/3 0.3)", "T"},
+	{"(eq 1/2 0.5)", "T"},
+	{"(eq (div 2 4) 1/2)", "T"},
+	{"(numerator 6/4)", "3"},
+	{"(denominator 6/4)", "2"},
+	{"(numerator 5)", "5"},
+	{"(denominator 5)", "1"},
+}
+
+func TestRational(t *testing.T) {
+	for _, test := range ratTests {
+		if got := strEval(test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+var stringTests = []struct {
+	in  string
+	out string
+}{
+	{`"hello"`, `"hello"`},
+	{`"a\tb\n\"c\""`, `"a\tb\n\"c\""`},
+	{`'("a" b)`, `("a" b)`},
+	{`(stringp "x")`, "T"},
+	{`(stringp 'x)`, "F"},
+	{`(eq "abc" "abc")`, "T"},
+	{`(eq "abc" 'abc)`, "F"},
+	{`(string-length "héllo")`, "5"},
+	{`(concat "foo" "bar" "")`, `"foobar"`},
+	{`(concat)`, `""`},
+	{`(substring "héllo" 1 3)`, `"él"`},
+	{`(substring "hello" 2)`, `"llo"`},
+	{`(cons 1 "nil")`, `(1 . "nil")`},
+	{`(list "nil")`, `("nil")`},
+	{`(string-index "héllo" "l")`, "2"},
+	{`(string-index "hello" "z")`, "-1"},
+	{`(string-upcase "Hello")`, `"HELLO"`},
+	{`(string-downcase "Hello")`, `"hello"`},
+	{`(string= "a" "a")`, "T"},
+	{`(string< "a" "b")`, "T"},
+	{`(string< "b" "a")`, "F"},
+	{`(eq (string-to-symbol "foo") 'foo)`, "T"},
+	{`(symbol-to-string 'foo)`, `"foo"`},
+	{`(string-to-number "-12")`, "-12"},
+	{`(string-to-number "1/2")`, "1/2"},
+	{`(string-to-number "2.5")`, "2.5"},
+	{`(string-to-number "12x")`, "nil"},
+	{`(string-to-number "")`, "nil"},
+	{`(number-to-string 3/4)`, `"3/4"`},
+}
+
+func TestString(t *testing.T) {
+	for _, test := range stringTests {
+		if got := strEval(test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+var charTests = []struct {
+	in  string
+	out string
+}{
+	{"(explode 'abc)", "(a b c)"},
+	{"(explode 'x12)", "(x 1 2)"},
+	{"(explode 123)", "(1 2 3)"},
+	{"(explode 1/2)", "(1 / 2)"},
+	{`(explode "a b")`, "(a   b)"},
+	{"(eq (car (explode 'xyz)) 'x)", "T"},
+	{"(unpack 'hi)", "(h i)"},
+	{"(implode '(a b c))", "abc"},
+	{"(eq (implode '(a b c)) 'abc)", "T"},
+	{"(implode '(1 2 3))", "123"},
+	{"(add 1 (implode '(1 2 3)))", "124"},
+	{"(pack '(foo bar))", "foobar"},
+	{"(implode (explode 'macroexpand-1))", "macroexpand-1"},
+	{"(eq (gensym) (gensym))", "F"},
+	// Each Context numbers its own gensyms.
+	{"(list (gensym) (gensym 'tmp))", "(g1 tmp2)"},
+	{"(atom (gensym))", "T"},
+	{"(car (explode (gensym 'tmp)))", "t"},
+	{"((lambda (g) (eq g (implode (explode g)))) (gensym))", "F"},
+	{"((lambda (g) (eq g g)) (gensym))", "T"},
+}
+
+func TestChar(t *testing.T) {
+	for _, test := range charTests {
+		if got := strEval(test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+var arrayTests = []struct {
+	in  string
+	out string
+}{
+	{"(make-vector 3 0)", "#(0 0 0)"},
+	{"(make-vector 0 0)", "#()"},
+	{"(array a (2 3) 'x)", "#(#(x x x) #(x x x))"},
+	{"(array a ((add 1 1)))", "#(nil nil)"},
+	{"(array a (2 2) 0) (aset a 1 0 5) a", "#(#(0 0) #(5 0))"},
+	{"(array a (2 2) 0) (aset a 1 0 5) (a 1 0)", "5"},
+	{"(array a (2 2) 0) (aset a 0 1 '(p q)) (aref a 0 1)", "(p q)"},
+	{"(setq v (make-vector 4 nil)) (aset v 3 'z) v", "#(nil nil nil z)"},
+	{"(setq v (make-vector 4 nil)) (v 0)", "nil"},
+	{"(array-length (make-vector 5 1))", "5"},
+	{"(array a (2 3)) (array-length a)", "6"},
+	{"(arrayp (make-vector 1 1))", "T"},
+	{"(arrayp '(1))", "F"},
+	{"(setq v (make-vector 1 1)) (eq v v)", "T"},
+	{"(eq (make-vector 1 1) (make-vector 1 1))", "F"},
+	// Arrays are functions of their subscripts.
+	{"(array sq (5) 0) (prog (i) (setq i 0) l (aset sq i (mul i i)) (setq i (add i 1)) (cond ((lt i 5) (go l)))) (mapcar sq '(1 2 4))", "(1 4 16)"},
+}
+
+func TestArray(t *testing.T) {
+	for _, test := range arrayTests {
+		c := NewContext(0)
+		evalAll(c, mapcarDefn)
+		if got := evalAll(c, test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+func TestArrayBounds(t *testing.T) {
+	for _, test := range []string{
+		"(aref (make-vector 2 0) 2)",
+		"(aref (make-vector 2 0) -1)",
+		"(aref (make-vector 2 0) 0 0)",
+		"(aref '(1 2) 0)",
+		"(array a (1000000000 1000000000) 0)",
+		"(array a (4294967296 4294967296 4294967296) 0)",
+		"(array a (0 4294967296) 0)",
+		"(make-vector 100000000 0)",
+	} {
+		func() {
+			defer func() {
+				if _, ok := recover().(Error); !ok {
+					t.Errorf("%s: no error", test)
+				}
+			}()
+			strEval(test)
+		}()
+	}
+}
+
+var hashTests = []struct {
+	in  string
+	out string
+}{
+	{"(make-hash-table)", "#<hash-table eq 0>"},
+	{"(setq h (make-hash-table 'equal)) (puthash '(a b) 1 h) h", "#<hash-table equal 1>"},
+	{"(setq h (make-hash-table)) (puthash 'a 1 h) (gethash 'a h)", "1"},
+	{"(setq h (make-hash-table)) (gethash 'a h)", "nil"},
+	{"(setq h (make-hash-table)) (gethash 'a h 'none)", "none"},
+	{"(setq h (make-hash-table)) (puthash 'a 1 h) (puthash 'a 2 h) (list (gethash 'a h) (hash-count h))", "(2 1)"},
+	{"(setq h (make-hash-table)) (puthash 12345678901234567890 'big h) (gethash 12345678901234567890 h)", "big"},
+	{"(setq h (make-hash-table)) (puthash 2 'two h) (gethash 2.0 h)", "two"},
+	{"(setq h (make-hash-table)) (puthash (expt 10 400) 'big h) (gethash (expt 10 400) h)", "big"},
+	{"(setq h (make-hash-table 'equal)) (puthash '(1/2 3) 'l h) (gethash '(0.5 3.0) h)", "l"},
+	{`(setq h (make-hash-table)) (puthash "k" 'v h) (gethash "k" h)`, "v"},
+	{"(setq h (make-hash-table)) (puthash nil 'empty h) (gethash nil h)", "empty"},
+	{"(setq h (make-hash-table)) (puthash '(a b) 1 h) (gethash '(a b) h)", "nil"},
+	// In an eq table, a cons is its own key.
+	{"(setq h (make-hash-table)) (setq k '(a)) (puthash k 1 h) (puthash k 2 h) (list (gethash k h) (hash-count h))", "(2 1)"},
+	{"(setq h (make-hash-table)) (setq k '(a)) (puthash k 1 h) (list (remhash k h) (gethash k h) (hash-count h))", "(T nil 0)"},
+	{"(setq h (make-hash-table)) (setq v (make-vector 1 0)) (puthash v 'v h) (gethash v h)", "v"},
+	{"(setq h (make-hash-table 'equal)) (puthash '(a b) 1 h) (puthash (list 'a 'b) 2 h) (list (gethash '(a b) h) (hash-count h))", "(2 1)"},
+	{"(setq h (make-hash-table 'equal)) (puthash 1/2 'half h) (gethash 0.5 h)", "half"},
+	{"(gethash 'a (make-hash-table 'equal) 'none)", "none"},
+	{"(setq h (make-hash-table)) (puthash 'a 1 h) (puthash 'b 2 h) (puthash 'c 3 h) (remhash 'b h) (remhash 'a h) (puthash 'a 4 h) (setq l nil) (maphash '(lambda (k v) (setq l (cons k l))) h) (list l (hash-count h) h)", "((a c) 2 #<hash-table eq 2>)"},
+	{"(setq h (make-hash-table)) (puthash 'a 1 h) (puthash 'b 2 h) (setq l nil) (maphash '(lambda (k v) (setq l (cons (list k (remhash 'b h)) l))) h) l", "((a T))"},
+	{"(setq h (make-hash-table 'equal)) (puthash '(a (b 1)) 1 h) (gethash '(a (b 1)) h)", "1"},
+	{"(setq h (make-hash-table 'equal)) (puthash '(a b) 1 h) (gethash '(a c) h)", "nil"},
+	{"(setq h (make-hash-table)) (puthash 'a 1 h) (list (remhash 'a h) (remhash 'a h) (hash-count h))", "(T F 0)"},
+	{"(setq h (make-hash-table)) (setq l nil) (puthash 'a 1 h) (puthash 'b 2 h) (maphash '(lambda (k v) (setq l (cons (list k v) l))) h) l", "((b 2) (a 1))"},
+	{`(setq memo (make-hash-table))
+	  (defn ((fib (lambda (n) (cond
+		((lt n 2) n)
+		((null (gethash n memo)) (puthash n (add (fib (sub n 1)) (fib (sub n 2))) memo))
+		(T (gethash n memo)))))))
+	  (fib 90)`,
+		"2880067194370816120",
+	},
+}
+
+func TestHash(t *testing.T) {
+	for _, test := range hashTests {
+		if got := evalAll(NewContext(0), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+// Numbers that are eq hash alike, and integers too large for a float64
+// to tell apart hash differently.
+func TestNumHash(t *testing.T) {
+	num := func(s string) *token {
+		return NewParser(strings.NewReader(s)).List().atom
+	}
+	for _, test := range []struct {
+		a, b string
+		same bool
+	}{
+		{"2", "2.0", true},
+		{"1/2", "0.5", true},
+		{"-3", "-3.0", true},
+		{"1e400", "1e400", true},
+		{"2", "-2", false},
+		{"9007199254740992", "9007199254740993", false},
+		{"123456789012345678901234567890", "123456789012345678901234567891", false},
+	} {
+		if same := numHash(num(test.a)) == numHash(num(test.b)); same != test.same {
+			t.Errorf("numHash(%s) == numHash(%s) is %t, expected %t", test.a, test.b, same, test.same)
+		}
+	}
+	keys := make(map[any]bool)
+	for i := 0; i < 100; i++ {
+		keys[numHash(num(fmt.Sprintf("1%0400d", i)))] = true
+	}
+	if len(keys) != 100 {
+		t.Errorf("100 large integers have %d hash keys", len(keys))
+	}
+}
+
+var destructiveTests = []struct {
+	in  string
+	out string
+}{
+	{"(setq x '(a b c)) (rplaca x 'z) x", "(z b c)"},
+	{"(setq x '(a b c)) (rplacd x '(y)) x", "(a y)"},
+	{"(nconc '(a b) '(c) nil '(d e))", "(a b c d e)"},
+	{"(nconc nil '(a))", "(a)"},
+	{"(nconc '(a) 'b)", "(a . b)"},
+	{"(nconc)", "nil"},
+	{"(setq x '(a b)) (nconc x '(c)) x", "(a b c)"},
+	{"(nreverse '(a b c d))", "(d c b a)"},
+	{"(nreverse nil)", "nil"},
+	// Circular and shared structure prints with labels.
+	{"(setq x '(a b)) (rplacd (cdr x) x) x", "#1=(a b . #1#)"},
+	{"(setq x '(a)) (rplaca x x) x", "#1=(#1#)"},
+	{"(setq x '(a b c)) (rplacd (cdr (cdr x)) (cdr x)) x", "(a . #1=(b c . #1#))"},
+	{"(setq v (make-vector 2 nil)) (aset v 0 v) v", "#1=#(#1# nil)"},
+	{"(setq x '(a)) (rplacd x x) (list 'quote x)", "'#1=(a . #1#)"},
+	// Shared structure that is not circular prints with labels too.
+	{"(setq x '(a b)) (list x x)", "(#1=(a b) #1#)"},
+	{"(setq x '(a)) (list x (list x) (copy x))", "(#1=(a) (#1#) (a))"},
+}
+
+// Equal finishes on circular lists, with an error if they are distinct.
+func TestEqualCycle(t *testing.T) {
+	const cycles = "(setq x '(a)) (rplacd x x) (setq y '(a)) (rplacd y y) "
+	if got := evalAll(NewContext(0), cycles+"(list (equal x x) (equal x '(a a)) (equal x '(b)))"); got != "(T F F)" {
+		t.Errorf("equal on a circular list = %s, expected (T F F)", got)
+	}
+	for _, test := range []string{
+		"(equal x y)",
+		"(member y (list x))",
+		"(assoc y (list (cons x 1)))",
+		"(subst 'b y x)",
+		"(setq h (make-hash-table 'equal)) (puthash x 1 h) (gethash y h)",
+		"(setq x '(a)) (rplaca x x) (setq y '(a)) (rplaca y y) (equal x y)",
+	} {
+		func() {
+			defer func() {
+				if _, ok := recover().(Error); !ok {
+					t.Errorf("%s: no error", test)
+				}
+			}()
+			evalAll(NewContext(0), cycles+test)
+		}()
+	}
+	// Shared structure that is not circular is not an error, however long.
+	if got := evalAll(NewContext(0), "(setq l (iota 20000)) (setq m (iota 20000)) (equal (list l l m) (list m m l))"); got != "T" {
+		t.Errorf("equal on shared lists = %s, expected T", got)
+	}
+}
+
+func TestDestructive(t *testing.T) {
+	for _, test := range destructiveTests {
+		if got := evalAll(NewContext(0), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+func TestCycleSExprString(t *testing.T) {
+	c := NewContext(0)
+	evalAll(c, "(setq x '(a)) (rplacd x x)")
+	got := c.Eval(NewParser(strings.NewReader("x")).List()).SExprString()
+	if want := "#1=(a . #1#)"; got != want {
+		t.Errorf("SExprString = %s, expected %s", got, want)
+	}
+}
+
+var mathTests = []struct {
+	in  string
+	out string
+}{
+	{"(expt 2 100)", "1267650600228229401496703205376"},
+	{"(expt 2 -2)", "1/4"},
+	{"(expt 2/3 2)", "4/9"},
+	{"(expt 1.5 2)", "2.25"},
+	{"(expt 4 0.5)", "2.0"},
+	{"(expt 2 1/2)", "1.4142135623730951"},
+	{"(expt 27 1/3)", "3.0"},
+	{"(expt 2 -0.5)", "0.7071067811865476"},
+	{"(expt -2 2.0)", "4.0"},
+	{"(expt 0.5 1e20)", "0.0"},
+	{"(expt -1.0 100000000000000000001)", "-1.0"},
+	{"(expt 0 0)", "1"},
+	{"(abs -5)", "5"},
+	{"(abs 5)", "5"},
+	{"(abs -1/2)", "1/2"},
+	{"(abs -2.5)", "2.5"},
+	{"(negate 3)", "-3"},
+	{"(negate -1/3)", "1/3"},
+	{"(min 3 1 2)", "1"},
+	{"(max 3 1.5 2)", "3"},
+	{"(max 1/2 0.25)", "1/2"},
+	{"(gcd 144 64)", "16"},
+	{"(gcd -12 18 27)", "3"},
+	{"(gcd)", "0"},
+	{"(gcd 123456789012345678901234567890 987654321098765432109876543210)", "9000000000900000000090"},
+	{"(lcm 4 6)", "12"},
+	{"(lcm 4 -6 5)", "60"},
+	{"(lcm 3 0)", "0"},
+	{"(sqrt 2)", "1.4142135623730951"},
+	{"(sqrt 16)", "4.0"},
+	{"(isqrt 17)", "4"},
+	{"(isqrt 100000000000000000000000000000000000000)", "10000000000000000000"},
+	{"(logand 12 10)", "8"},
+	{"(logor 12 10)", "14"},
+	{"(logxor 12 10)", "6"},
+	{"(logand -1 255)", "255"},
+	{"(leftshift 1 70)", "1180591620717411303424"},
+	{"(leftshift 256 -4)", "16"},
+	{"(leftshift -5 -1)", "-3"},
+	{"(numberp 1)", "T"},
+	{"(numberp 'a)", "F"},
+	{"(numberp nil)", "F"},
+	{"(zerop 0.0)", "T"},
+	{"(zerop 1/2)", "F"},
+	{"(minusp -1/2)", "T"},
+	{"(minusp 0)", "F"},
+	{"(onep 1.0)", "T"},
+	{"(onep 2)", "F"},
+	{"(evenp 10)", "T"},
+	{"(evenp -3)", "F"},
+	{"(oddp -3)", "T"},
+}
+
+func TestMath(t *testing.T) {
+	for _, test := range mathTests {
+		if got := strEval(test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+var operatorTests = []struct {
+	in  string
+	out string
+}{
+	{"(+ 1 2)", "3"},
+	{"(- 5 3)", "2"},
+	{"(- -5 3)", "-8"},
+	{"(* 4 -2)", "-8"},
+	{"(/ 1 3)", "1/3"},
+	{"(< 1 2)", "T"},
+	{"(<= 2 2)", "T"},
+	{"(> 1 2)", "F"},
+	{"(>= 3 2)", "T"},
+	{"(= 2 2.0)", "T"},
+	{"(/= 1 2)", "T"},
+	{"(+ 1 2 3)", "6"},
+	{"(+ 5)", "5"},
+	{"(+)", "0"},
+	{"(* 2 3 4)", "24"},
+	{"(*)", "1"},
+	{"(- 10 3 2)", "5"},
+	{"(- 5)", "-5"},
+	{"(- 1/2)", "-1/2"},
+	{"(/ 12 2 3)", "2"},
+	{"(/ 4)", "1/4"},
+	{"(/ 2.0)", "0.5"},
+	{"(< 1 2 3)", "T"},
+	{"(< 1 3 2)", "F"},
+	{"(<= 1 1 2)", "T"},
+	{"(> 3 2 1)", "T"},
+	{"(>= 3 3 4)", "F"},
+	{"(= 1 1.0 2/2)", "T"},
+	{"(= 1 1 2)", "F"},
+	{"(< 1)", "T"},
+	{"(/= 1 2 3)", "T"},
+	{"(/= 1 2 1)", "F"},
+	{"'(+ - * / -x +1 -2 1/2)", "(+ - * / -x 1 -2 1/2)"},
+	{"(numberp '-)", "F"},
+	{"(numberp '-1)", "T"},
+	{"(defn ((inc+ (lambda (n) (+ n 1))))) (inc+ 2)", "3"},
+	{"(defn ((*x* (lambda () 'star)))) (*x*)", "star"},
+}
+
+func TestOperator(t *testing.T) {
+	for _, test := range operatorTests {
+		if got := evalAll(NewContext(0), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+// The two-argument functions and the operators reject the wrong number of arguments.
+func TestArity(t *testing.T) {
+	for _, test := range []string{
+		"(add 1 2 3)",
+		"(sub 5)",
+		"(lt 1 2 3)",
+		"(ne 1)",
+		"(-)",
+		"(/)",
+		"(<)",
+		"(/=)",
+		"(+ 1 'a)",
+		"(< 1 2 'a)",
+	} {
+		func() {
+			defer func() {
+				if _, ok := recover().(Error); !ok {
+					t.Errorf("%s: no error", test)
+				}
+			}()
+			evalAll(NewContext(0), test)
+		}()
+	}
+}
+
+var libraryTests = []struct {
+	in  string
+	out string
+}{
+	{"(append '(a b) '(c) nil '(d))", "(a b c d)"},
+	{"(append)", "nil"},
+	{"(append '(a) 'b)", "(a . b)"},
+	{"(reverse '(a (b c) d))", "(d (b c) a)"},
+	{"(length '(a b c))", "3"},
+	{"(length nil)", "0"},
+	{"(maplist 'length '(a b c))", "(3 2 1)"},
+	{"(mapcon '(lambda (l) (list (car l) (car l))) '(a b c))", "(a a b b c c)"},
+	{"(map '(lambda (l) (setq last l)) '(a b))", "nil"},
+	{"(setq n 0) (map '(lambda (l) (setq n (add n (car l)))) '(1 2 3)) n", "6"},
+	{"(mapcar 'car '((a 1) (b 2)))", "(a b)"},
+	{"(mapcar '(lambda (x) (mul x x)) '(1 2 3))", "(1 4 9)"},
+	{"(search '(1 2 -3 4) '(lambda (l) (minusp (car l))) 'car '(lambda (x) 'none))", "-3"},
+	{"(search '(1 2) '(lambda (l) (minusp (car l))) 'car '(lambda (x) 'none))", "none"},
+	{"(subst 'x '(a) '(b (a) c (a)))", "(b x c x)"},
+	{"(sublis '((a . 1) (b . 2)) '(a (b c) . a))", "(1 (2 c) . 1)"},
+	{"(pair '(a b) '(1 2))", "((a . 1) (b . 2))"},
+	{"(assoc '(k) '((a . 1) ((k) . 2)))", "((k) . 2)"},
+	{"(assoc 'z '((a . 1)))", "nil"},
+	{"(member '(b) '(a (b) c))", "T"},
+	{"(member 'd '(a b c))", "F"},
+	{"(last '(a b c))", "(c)"},
+	{"(last nil)", "nil"},
+	{"(nth 1 '(a b c))", "b"},
+	{"(nth 5 '(a b c))", "nil"},
+	// A user's definition replaces the library function.
+	{"(defn ((length (lambda (l) 'mine)))) (length '(a))", "mine"},
+	// Library functions do not use up the call depth.
+	{"(length (maplist 'car (mapcar '(lambda (x) x) (explode 'abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz))))", "52"},
+}
+
+func TestLibrary(t *testing.T) {
+	for _, test := range libraryTests {
+		if got := evalAll(NewContext(20), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+}
+
+func TestLibraryArgs(t *testing.T) {
+	for _, test := range []string{
+		"(length '(a) '(b))",
+		"(length 'a)",
+		"(pair '(a) '(1 2))",
+		"(nth -1 '(a))",
+	} {
+		func() {
+			defer func() {
+				if _, ok := recover().(Error); !ok {
+					t.Errorf("%s: no error", test)
+				}
+			}()
+			strEval(test)
+		}()
+	}
+}
+
+var ioTests = []struct {
+	in     string
+	input  string // Text for read.
+	out    string // Result.
+	output string // Text written.
+}{
+	{"(print '(a b))", "", "(a b)", "(a b)\n"},
+	{"(prin1 'a) (prin1 \"b c\")", "", `"b c"`, `a"b c"`},
+	{"(princ 'a) (princ \"b c\")", "", `"b c"`, "ab c"},
+	{`(princ '("x" 1.5 1/2))`, "", `("x" 1.5 1/2)`, "(x 1.5 1/2)"},
+	{"(print ''x)", "", "'x", "'x\n"},
+	{"(terpri)", "", "nil", "\n"},
+	{"(read)", "(a . b)", "(a . b)", ""},
+	{"(read) (read)", "first\n\n  (second)\n", "(second)", ""},
+	{"(cons (read) (read))", "1 \"two\"", `(1 . "two")`, ""},
+	{"(eval (read))", "(add 1 2)", "3", ""},
+	{`(defn ((echo (lambda () (prog (x)
+		loop	(setq x (read))
+			(cond ((eq x 'stop) (return 'done)))
+			(print x)
+			(go loop))))))
+		(echo)`,
+		"a (b c)\n stop d",
+		"done",
+		"a\n(b c)\n",
+	},
+}
+
+func TestIO(t *testing.T) {
+	for _, test := range ioTests {
+		var b strings.Builder
+		c := NewContext(0, Input(NewParser(strings.NewReader(test.input))), Output(&b))
+		if got := evalAll(c, test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+		if b.String() != test.output {
+			t.Errorf("%s: wrote %q, expected %q", test.in, b.String(), test.output)
+		}
+	}
+}
+
+func TestReadEOF(t *testing.T) {
+	defer func() {
+		if _, ok := recover().(Error); !ok {
+			t.Error("no error")
+		}
+	}()
+	c := NewContext(0, Input(NewParser(strings.NewReader("a\n"))))
+	evalAll(c, "(read) (read)")
+}
+
+var streamTests = []struct {
+	in  string
+	out string
+}{
+	{`(with-open-file (s file 'output) (print '(a "b") s) (write-string "line two" s) (terpri s))`, "nil"},
+	{`(with-open-file (s file) (read s))`, `(a "b")`},
+	{`(with-open-file (s file) (read s) (read-line s) (read-line s))`, `"line two"`},
+	{`(with-open-file (s file) (read s) (read-line s) (read-line s) (read-line s 'done))`, "done"},
+	{`(with-open-file (s file) (list (read-char s) (read-char s) (read-char s)))`, "(( a  )"},
+	{`(with-open-file (s file) (read s) (read s) (read s) (read s 'eof))`, "eof"},
+	{`(setq s (open file 'append)) (princ "more" s) (close s) s`, "#<stream closed FILE>"},
+	{`(setq s (open file)) (read-line s) (read-line s) (read-line s)`, `"more"`},
+	{`(streamp (open file))`, "T"},
+	{`(streamp file)`, "F"},
+}
+
+func TestStream(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data")
+	c := NewContext(0)
+	c.set(mkAtom("file"), stringExpr(file))
+	for _, test := range streamTests {
+		out := strings.Replace(test.out, "FILE", file, 1)
+		if got := evalAll(c, test.in); got != out {
+			t.Errorf("%s = %s, expected %s", test.in, got, out)
+		}
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data")
+	c := NewContext(0)
+	c.set(mkAtom("file"), stringExpr(file))
+	for _, test := range []string{
+		"(open file)", // Does not exist.
+		"(open file 'sideways)",
+		"(with-open-file (s file 'output) (setq saved s) (undefined))",
+		"(read saved)",
+		"(with-open-file (s file) (write-string \"x\" s))",
+		"(with-open-file (s file) (read s))",
+	} {
+		func() {
+			defer func() {
+				if _, ok := recover().(Error); !ok {
+					t.Errorf("%s: no error", test)
+				}
+				c.PopStack()
+			}()
+			evalAll(c, test)
+		}()
+	}
+	// The error closed the stream.
+	if got, want := evalAll(c, "saved"), "#<stream closed "+file+">"; got != want {
+		t.Errorf("saved = %s, expected %s", got, want)
+	}
+}
+
+// An error closing the file in with-open-file does not hide an error
+// from the body.
+func TestWithOpenFileCloseError(t *testing.T) {
+	// closeFile closes the stream's file behind its back,
+	// so closing the stream fails.
+	closeFile := mkAtom("close-file")
+	elementary[closeFile] = func(c *Context, name *token, expr *Expr) *Expr {
+		getStream(name, Car(expr)).file.Close()
+		return nil
+	}
+	defer delete(elementary, closeFile)
+	c := NewContext(0)
+	c.set(mkAtom("file"), stringExpr(filepath.Join(t.TempDir(), "data")))
+	for _, test := range []struct {
+		in  string
+		err string
+	}{
+		{"(with-open-file (s file 'output) (close-file s) (undefined))", "undefined"},
+		{"(with-open-file (s file 'output) (close-file s) 'ok)", "already closed"},
+	} {
+		func() {
+			defer func() {
+				e, ok := recover().(Error)
+				if !ok || !strings.Contains(string(e), test.err) {
+					t.Errorf("%s: error %q, expected %q", test.in, e, test.err)
+				}
+				c.PopStack()
+			}()
+			evalAll(c, test.in)
+		}()
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"main.lisp":   "(require 'a)\n(require 'b)\n(setq result (list a b))\n",
+		"a.lisp":      "(require 'b) ; Requires b, which requires a.\n(setq loads (add loads 1))\n(setq a 'A)\n",
+		"b.lisp":      "(require 'a)\n(setq loads (add loads 1))\n(setq b 'B)\n",
+		"bad.lisp":    "(setq ok T)\n(undefined 1)\n(setq ok F)\n",
+		"nested.lisp": "(load bad)\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewContext(0, LibraryPath([]string{t.TempDir(), dir}))
+	c.set(mkAtom("loads"), intExpr(0))
+	if err := c.Load(filepath.Join(dir, "main.lisp")); err != nil {
+		t.Fatal(err)
+	}
+	if got := evalAll(c, "(list result loads (require 'a) (provide 'c) (require 'c))"); got != "((A B) 2 F c F)" {
+		t.Errorf("after load: %s", got)
+	}
+	// An error stops loading, and restores the stack.
+	err := c.Load(filepath.Join(dir, "bad.lisp"))
+	if _, ok := err.(Error); !ok || !strings.Contains(err.Error(), "bad.lisp") {
+		t.Errorf("load bad.lisp: error %v", err)
+	}
+	if got := evalAll(c, "ok"); got != "T" {
+		t.Errorf("ok = %s after error", got)
+	}
+	if len(c.scope) != 1 {
+		t.Errorf("stack depth %d after error", len(c.scope))
+	}
+	if err := c.Load(filepath.Join(dir, "missing.lisp")); !os.IsNotExist(err) {
+		t.Errorf("load missing.lisp: error %v", err)
+	}
+	c.set(mkAtom("bad"), stringExpr(filepath.Join(dir, "bad.lisp")))
+	for _, test := range []string{
+		"(load bad)",
+		"(require 'missing)",
+		"(load (concat bad \"x\"))",
+	} {
+		func() {
+			defer func() {
+				if _, ok := recover().(Error); !ok {
+					t.Errorf("%s: no error", test)
+				}
+				c.PopStack()
+			}()
+			evalAll(c, test)
+		}()
+	}
+	if err := c.Load(filepath.Join(dir, "nested.lisp")); err == nil || !strings.Contains(err.Error(), "undefined") {
+		t.Errorf("load nested.lisp: error %v", err)
+	}
+}
+
+var preludeTests = []struct {
+	in  string
+	out string
+}{
+	{"(fac 10)", "3628800"},
+	{"(equal '(a (b)) '(a (b)))", "T"},
+	{"(not (eq 'a 'b))", "T"},
+	{"(notnull '(a))", "T"},
+	{"(union '(a b) '(b c))", "(a b c)"},
+	{"(intersection '(a b) '(b c))", "(b)"},
+	{"(set-difference '(a b c) '(b))", "(a c)"},
+	{"(setq x '((a) b)) (eq (car (copy x)) (car x))", "F"},
+	{"(efface 'b '(a b c b))", "(a c b)"},
+	{"(remove 'b '(a b c b))", "(a c)"},
+	{"(filter 'oddp '(1 2 3 4 5))", "(1 3 5)"},
+	{"(reduce 'add '(1 2 3 4) 0)", "10"},
+	{"(reduce '(λ (l x) (cons x l)) '(a b c) nil)", "(c b a)"},
+	{"(iota 4)", "(0 1 2 3)"},
+	{"(sort '(3 1 4 1 5 9 2 6) 'lt)", "(1 1 2 3 4 5 6 9)"},
+	{`(sort '("b" "c" "a") 'string<)`, `("a" "b" "c")`},
+	{"(if (eq 1 1) 'yes 'no)", "yes"},
+	{"(let ((x 1) (y 2)) (add x y))", "3"},
+}
+
+func TestPrelude(t *testing.T) {
+	for _, test := range preludeTests {
+		if got := evalAll(NewContext(0), test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+	// The a-list evaluator has the prelude's functions too.
+	if got := evalAll(NewContext(0, AList(true)), "(union '(a) '(b))"); got != "(a b)" {
+		t.Errorf("a-list union: %s", got)
+	}
+	defer func() {
+		if _, ok := recover().(Error); !ok {
+			t.Error("fac defined without prelude")
+		}
+	}()
+	evalAll(NewContext(0, Prelude(false)), "(fac 3)")
+}
+
+func TestOS(t *testing.T) {
+	t.Setenv("LISP_TEST", "value")
+	c := NewContext(0, OS([]string{"a", "b c"}))
+	for _, test := range []struct {
+		in  string
+		out string
+	}{
+		{"(args)", `("a" "b c")`},
+		{`(getenv "LISP_TEST")`, `"value"`},
+		{`(getenv "LISP_TEST_UNSET")`, "nil"},
+		{"(gt (time) 1600000000)", "T"},
+		{"(setq t0 (elapsed)) (sleep 1/100) (ge (sub (elapsed) t0) 0.01)", "T"},
+	} {
+		if got := evalAll(c, test.in); got != test.out {
+			t.Errorf("%s = %s, expected %s", test.in, got, test.out)
+		}
+	}
+	for _, test := range []struct {
+		in     string
+		status Exit
+	}{
+		{"(exit)", 0},
+		{"(exit 3)", 3},
+		{"(prog () (exit 4) (return 'no))", 4},
+	} {
+		func() {
+			defer func() {
+				if e := recover(); e != test.status {
+					t.Errorf("%s: recovered %#v, expected exit %d", test.in, e, test.status)
+				}
+			}()
+			evalAll(c, test.in)
+		}()
+	}
+	// Without the option, there are no operating system functions.
+	func() {
+		defer func() {
+			if _, ok := recover().(Error); !ok {
+				t.Error("exit defined without OS option")
+			}
+		}()
+		strEval("(exit 1)")
+	}()
+	// Statuses that the operating system cannot represent are errors.
+	for _, test := range []string{"(exit -1)", "(exit 256)"} {
+		func() {
+			defer func() {
+				if _, ok := recover().(Error); !ok {
+					t.Errorf("%s: no error", test)
+				}
+			}()
+			evalAll(c, test)
+		}()
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2020 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// This file contains the implementation of hash tables and their elementary
+// (builtin) functions. A table compares keys with eq, so atoms match only
+// themselves and numbers and strings match by value, or with equal, so
+// lists with the same structure match too.
+
+package lisp1_5
+
+import (
+	"hash/fnv"
+	"io"
+	"math/big"
+)
+
+type hashEntry struct {
+	key, value *Expr
+	removed    bool // Whether remhash has removed the entry.
+}
+
+// A hashTable maps keys to values. Entries with the same hash key are
+// kept in a bucket and told apart by eq or equal. The entries are also
+// kept in the order they were added, so maphash is deterministic. Removing
+// an entry only marks it, so remhash need not search the list; the list is
+// compacted once most of it is removed entries.
+type hashTable struct {
+	equal   bool
+	buckets map[any][]*hashEntry
+	entries []*hashEntry
+	count   int // The number of entries not removed.
+}
+
+func newHashTable(equal bool) *Expr {
+	h := &hashTable{
+		equal:   equal,
+		buckets: make(map[any][]*hashEntry),
+	}
+	return atomExpr(&token{typ: tokenHash, hash: h})
+}
+
+func (h *hashTable) kind() string {
+	if h.equal {
+		return "equal"
+	}
+	return "eq"
+}
+
+// same reports whether the keys match. In an eq table, a cons matches
+// only itself, as its bucket is keyed by its address.
+func (h *hashTable) same(a, b *Expr) bool {
+	if h.equal {
+		return equal(a, b)
+	}
+	return a == b || eq(a, b)
+}
+
+// hashKey returns the map key of the bucket for the expression.
+func (h *hashTable) hashKey(e *Expr) any {
+	if h.equal {
+		f := fnv.New64a()
+		budget := 1000
+		hashExpr(f, e, &budget)
+		return f.Sum64()
+	}
+	if e == nil {
+		return nil
+	}
+	switch atom := e.atom; {
+	case atom == nil:
+		return e
+	case atom.typ == tokenNumber:
+		return numHash(atom)
+	case atom.typ == tokenString:
+		return atom.text
+	default:
+		return atom
+	}
+}
+
+// A numKey is the hash key of a number whose value is m×2**exp for an odd
+// integer m, or zero: every integer and float, and each rational whose
+// denominator is a power of two. Numbers that are eq have the same key
+// whatever their kinds, and the key does not depend on the float precision.
+type numKey struct {
+	mant string // The sign and the bytes of the absolute value of m.
+	exp  int
+}
+
+// A ratKey is the hash key of any other rational, which no integer or
+// float can equal.
+type ratKey struct {
+	num, den string
+}
+
+func signedBytes(i *big.Int) string {
+	sign := "+"
+	if i.Sign() < 0 {
+		sign = "-"
+	}
+	return sign + string(i.Bytes())
+}
+
+// dyadicKey returns the numKey of m×2**exp.
+func dyadicKey(m *big.Int, exp int) numKey {
+	if m.Sign() == 0 {
+		return numKey{}
+	}
+	z := m.TrailingZeroBits()
+	return numKey{signedBytes(new(big.Int).Rsh(m, z)), exp + int(z)}
+}
+
+// numHash returns a hash key for the number. Numbers that are eq,
+// such as 2, 4/2 and 2.0, or 1/2 and 0.5, have the same key.
+func numHash(t *token) any {
+	switch numKind(t) {
+	case intKind:
+		return dyadicKey(t.num, 0)
+	case ratKind:
+		den := t.rat.Denom()
+		if z := den.TrailingZeroBits(); den.BitLen() == int(z)+1 {
+			return dyadicKey(t.rat.Num(), -int(z))
+		}
+		return ratKey{signedBytes(t.rat.Num()), string(den.Bytes())}
+	}
+	// A float is mant×2**exp with 0.5 <= |mant| < 1; make mant an integer.
+	if t.flt.Sign() == 0 {
+		return numKey{}
+	}
+	mant := new(big.Float)
+	exp := t.flt.MantExp(mant)
+	prec := int(t.flt.MinPrec())
+	m, _ := mant.SetMantExp(mant, prec).Int(nil)
+	return dyadicKey(m, exp-prec)
+}
+
+// hashExpr writes a structural hash of the expression to w. It examines
+// at most budget conses and atoms, so it terminates even on circular lists.
+func hashExpr(w io.Writer, e *Expr, budget *int) {
+	if *budget--; *budget < 0 {
+		return
+	}
+	switch {
+	case e == nil:
+		w.Write([]byte{0})
+	case e.atom == nil:
+		w.Write([]byte{'('})
+		hashExpr(w, e.car, budget)
+		hashExpr(w, e.cdr, budget)
+	case e.atom.typ == tokenNumber:
+		w.Write([]byte{'#'})
+		switch k := numHash(e.atom).(type) {
+		case numKey:
+			writeUint64(w, uint64(k.exp))
+			writeString(w, k.mant)
+		case ratKey:
+			writeString(w, k.num)
+			writeString(w, k.den)
+		}
+	default:
+		// Symbols hash by name; distinct uninterned atoms with the
+		// same name share a bucket but are told apart by eq.
+		io.WriteString(w, e.atom.text)
+		w.Write([]byte{0})
+	}
+}
+
+// writeUint64 writes the bytes of x to w, low byte first.
+func writeUint64(w io.Writer, x uint64) {
+	var buf [8]byte
+	for i := range buf {
+		buf[i] = byte(x >> (8 * i))
+	}
+	w.Write(buf[:])
+}
+
+// writeString writes the length of s and then s to w.
+func writeString(w io.Writer, s string) {
+	writeUint64(w, uint64(len(s)))
+	io.WriteString(w, s)
+}
+
+// equalBudget is the number of conses equal compares before it starts
+// to watch for cycles.
+const equalBudget = 10000
+
+// equal reports whether the expressions have the same structure
+// and eq atoms. Comparing circular lists that are not the same list
+// is an error, since the comparison would never end.
+func equal(a, b *Expr) bool {
+	e := &equality{}
+	return e.equal(a, b)
+}
+
+// equality holds the state of a comparison by equal. Once the budget is
+// spent, path holds the pairs of conses whose comparison is in progress;
+// meeting one of them again means the lists are circular.
+type equality struct {
+	steps int
+	path  map[[2]*Expr]bool
+}
+
+func (e *equality) equal(a, b *Expr) bool {
+	var added [][2]*Expr
+	defer func() {
+		for _, k := range added {
+			delete(e.path, k)
+		}
+	}()
+	for {
+		if a == b {
+			return true
+		}
+		if a == nil || b == nil || a.atom != nil || b.atom != nil {
+			return eq(a, b)
+		}
+		if e.steps++; e.steps > equalBudget {
+			if e.path == nil {
+				e.path = make(map[[2]*Expr]bool)
+			}
+			k := [2]*Expr{a, b}
+			if e.path[k] {
+				errorf("equal: circular list")
+			}
+			e.path[k] = true
+			added = append(added, k)
+		}
+		if !e.equal(a.car, b.car) {
+			return false
+		}
+		a, b = a.cdr, b.cdr
+	}
+}
+
+func (h *hashTable) lookup(key *Expr) *hashEntry {
+	for _, e := range h.buckets[h.hashKey(key)] {
+		if h.same(e.key, key) {
+			return e
+		}
+	}
+	return nil
+}
+
+func (h *hashTable) put(key, value *Expr) {
+	if e := h.lookup(key); e != nil {
+		e.value = value
+		return
+	}
+	e := &hashEntry{key: key, value: value}
+	hk := h.hashKey(key)
+	h.buckets[hk] = append(h.buckets[hk], e)
+	h.entries = append(h.entries, e)
+	h.count++
+}
+
+func (h *hashTable) remove(key *Expr) bool {
+	hk := h.hashKey(key)
+	bucket := h.buckets[hk]
+	for i, e := range bucket {
+		if !h.same(e.key, key) {
+			continue
+		}
+		if len(bucket) == 1 {
+			delete(h.buckets, hk)
+		} else {
+			h.buckets[hk] = append(bucket[:i:i], bucket[i+1:]...)
+		}
+		e.removed = true
+		h.count--
+		if h.count < len(h.entries)/2 {
+			h.compact()
+		}
+		return true
+	}
+	return false
+}
+
+// compact drops the removed entries from h.entries.
+func (h *hashTable) compact() {
+	entries := make([]*hashEntry, 0, h.count)
+	for _, e := range h.entries {
+		if !e.removed {
+			entries = append(entries, e)
+		}
+	}
+	h.entries = entries
+}
+
+// getHash returns the hash table represented by the expression.
+func getHash(expr *Expr) *hashTable {
+	atom := expr.getAtom()
+	if atom == nil || atom.typ != tokenHash {
+		errorf("expect hash table; have %s", expr)
+	}
+	return atom.hash
+}
+
+// (make-hash-table [test]) returns a new hash table. The test, eq by
+// default, may be eq or equal.
+func (c *Context) makeHashTableFunc(name *token, expr *Expr) *Expr {
+	switch test := Car(expr); {
+	case test == nil || test.getAtom() == tokEq:
+		return newHashTable(false)
+	case test.getAtom() == tokEqual:
+		return newHashTable(true)
+	default:
+		errorf("make-hash-table: unknown test %s", test)
+	}
+	return nil
+}
+
+// (gethash key table [default]) returns the value stored under the key,
+// or the default, nil if absent, if there is none.
+func (c *Context) gethashFunc(name *token, expr *Expr) *Expr {
+	if e := getHash(Car(Cdr(expr))).lookup(Car(expr)); e != nil {
+		return e.value
+	}
+	return Car(Cdr(Cdr(expr)))
+}
+
+// (puthash key value table) stores the value under the key and returns the value.
+func (c *Context) puthashFunc(name *token, expr *Expr) *Expr {
+	value := Car(Cdr(expr))
+	getHash(Car(Cdr(Cdr(expr)))).put(Car(expr), value)
+	return value
+}
+
+// (remhash key table) removes the key, reporting whether it was present.
+func (c *Context) remhashFunc(name *token, expr *Expr) *Expr {
+	return truthExpr(getHash(Car(Cdr(expr))).remove(Car(expr)))
+}
+
+// (hash-count table) returns the number of entries in the table.
+func (c *Context) hashCountFunc(name *token, expr *Expr) *Expr {
+	return intExpr(getHash(Car(expr)).count)
+}
+
+// (maphash fn table) calls (fn key value) for each entry in the table,
+// in the order the keys were added, and returns nil.
+func (c *Context) maphashFunc(name *token, expr *Expr) *Expr {
+	fn := Car(expr)
+	h := getHash(Car(Cdr(expr)))
+	// Copy the entries so fn can modify the table.
+	for _, e := range append([]*hashEntry(nil), h.entries...) {
+		if e.removed {
+			continue // Removed by fn.
+		}
+		c.apply("maphash", fn, Cons(e.key, Cons(e.value, nil)))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// This file contains the definitions of the input and output elementary
+// (builtin) functions. Read parses expressions from the context's input;
+// print, prin1, princ and terpri write to its output. Each takes an
+// optional stream to use instead; see stream.go.
+
+package lisp1_5
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// Input returns an Option that sets the parser from which read takes its
+// input. By default, read parses standard input. A program that also reads
+// standard input itself, as the interactive interpreter does, should share
+// its parser so no input is lost to buffering. NewContext sets the parser
+// to read floating-point numbers with the context's precision.
+func Input(p *Parser) Option {
+	return func(c *Context) {
+		c.input = p
+	}
+}
+
+// Output returns an Option that sets the writer to which print and its
+// relatives write. By default, they write to standard output.
+func Output(w io.Writer) Option {
+	return func(c *Context) {
+		c.output = w
+	}
+}
+
+// parser returns the parser for the context's input, creating
+// one for standard input if none has been set.
+func (c *Context) parser() *Parser {
+	if c.input == nil {
+		c.input = c.newParser(bufio.NewReader(os.Stdin))
+	}
+	return c.input
+}
+
+// newParser returns a parser that reads floating-point numbers
+// with the context's precision.
+func (c *Context) newParser(r io.RuneReader) *Parser {
+	p := NewParser(r)
+	p.lex.prec = c.floatPrec
+	return p
+}
+
+// write writes the string to the stream, or to the context's output if
+// the stream is nil.
+func (c *Context) write(name *token, stream *Expr, s string) {
+	if _, err := io.WriteString(c.writer(name, stream), s); err != nil {
+		errorf("%s: %v", name, err)
+	}
+}
+
+// princString returns the expression as String does, but with
+// strings printed without quotes or escapes.
+func princString(e *Expr) string {
+	var b strings.Builder
+	p := newPrinter(&b, e, printSExpr, !printSExpr)
+	p.princ = true
+	p.print(e)
+	return b.String()
+}
+
+// (read stream eof) parses and returns the next expression from the
+// stream. At end of file, it returns eof if present, and otherwise
+// is an error.
+func (c *Context) readFunc(name *token, expr *Expr) *Expr {
+	p := c.inputParser(name, Car(expr))
+	for {
+		switch p.SkipSpace() {
+		case '\n':
+			continue
+		case EofRune:
+			return eof(name, expr)
+		}
+		return p.List()
+	}
+}
+
+// (print x stream) writes x and a newline to the stream, and returns x.
+func (c *Context) printFunc(name *token, expr *Expr) *Expr {
+	x := Car(expr)
+	c.write(name, Car(Cdr(expr)), x.String()+"\n")
+	return x
+}
+
+// (prin1 x stream) writes x to the stream, and returns x.
+func (c *Context) prin1Func(name *token, expr *Expr) *Expr {
+	x := Car(expr)
+	c.write(name, Car(Cdr(expr)), x.String())
+	return x
+}
+
+// (princ x stream) writes x to the stream with strings printed without
+// quotes, and returns x.
+func (c *Context) princFunc(name *token, expr *Expr) *Expr {
+	x := Car(expr)
+	c.write(name, Car(Cdr(expr)), princString(x))
+	return x
+}
+
+// (terpri stream) writes a newline to the stream.
+func (c *Context) terpriFunc(name *token, expr *Expr) *Expr {
+	c.write(name, Car(expr), "\n")
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"math/big"
 	"os"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -29,43 +30,68 @@ const (
 	tokenChar
 	tokenQuote
 	tokenNewline
+	tokenFunarg
+	tokenBackquote
+	tokenComma
+	tokenCommaAt
+	tokenString
+	tokenArray
+	tokenHash
+	tokenStream
+	tokenLabel    // #n= labels the following expression.
+	tokenLabelRef // #n# refers to a labeled expression.
 )
 
 const EofRune rune = -1 // Returned by Parser.SkipSpace at EOF.
 
 // A token is a Lisp atom, including a number.
 type token struct {
-	typ  TokType
-	text string   // User's input text, empty for numbers.
-	num  *big.Int // Nil for non-numbers.
+	typ    TokType
+	text   string     // User's input text, empty for numbers; the value of a string.
+	num    *big.Int   // Nil for non-numbers, rationals and floating-point numbers.
+	rat    *big.Rat   // Non-nil for rationals.
+	flt    *big.Float // Non-nil for floating-point numbers.
+	funarg *funarg    // Nil for non-funargs.
+	array  *array     // Nil for non-arrays.
+	hash   *hashTable // Nil for non-hash tables.
+	stream *stream    // Nil for non-streams.
 }
 
 func (t token) String() string {
-	if t.typ == tokenNumber {
+	switch t.typ {
+	case tokenNumber:
+		switch {
+		case t.flt != nil:
+			return formatFloat(t.flt)
+		case t.rat != nil:
+			return t.rat.RatString()
+		}
 		return fmt.Sprint(t.num)
+	case tokenFunarg, tokenArray:
+		return atomExpr(&t).String()
+	case tokenString:
+		return strconv.Quote(t.text)
+	case tokenHash:
+		return fmt.Sprintf("#<hash-table %s %d>", t.hash.kind(), t.hash.count)
+	case tokenStream:
+		return t.stream.String()
 	}
 	return t.text
 }
 
-func (t token) buildString(b *strings.Builder) {
-	if t.typ == tokenNumber {
-		b.WriteString(fmt.Sprint(t.num))
-	} else {
-		b.WriteString(t.text)
-	}
-}
-
 type lexer struct {
 	rd       io.RuneReader
 	peeking  bool
 	peekRune rune
 	last     rune
 	buf      bytes.Buffer
+	prec     uint // The precision of floating-point numbers.
 }
 
 func newLexer(rd io.RuneReader) *lexer {
 	return &lexer{
-		rd: rd,
+		rd:   rd,
+		prec: defaultFloatPrec,
 	}
 }
 
@@ -84,14 +110,53 @@ func mkToken(typ TokType, text string) *token {
 	}
 	tok := atoms[text]
 	if tok == nil {
-		tok = &token{typ, text, &zero}
+		tok = &token{typ: typ, text: text, num: &zero}
 		atoms[text] = tok
 	}
 	return tok
 }
 
 func number(num *big.Int) *token {
-	return &token{tokenNumber, "", num}
+	return &token{typ: tokenNumber, num: num}
+}
+
+// floatNumber returns the float as a number. Floats have no infinities,
+// so a result too large to represent is an error.
+func floatNumber(f *big.Float) *token {
+	if f.IsInf() {
+		errorf("floating-point overflow")
+	}
+	return &token{typ: tokenNumber, flt: f}
+}
+
+// ratNumber returns the rational as a number, which is an integer
+// if the denominator is 1.
+func ratNumber(r *big.Rat) *token {
+	if r.IsInt() {
+		return number(new(big.Int).Set(r.Num()))
+	}
+	return &token{typ: tokenNumber, rat: r}
+}
+
+func mkRat(text string) *token {
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		errorf("bad number syntax: %s", text)
+	}
+	return ratNumber(r)
+}
+
+func mkFloat(text string, prec uint) *token {
+	f, _, err := big.ParseFloat(text, 10, prec, big.ToNearestEven)
+	if err != nil {
+		errorf("bad number syntax: %s", text)
+	}
+	return floatNumber(f)
+}
+
+// mkString returns a string. Unlike atoms, strings are not interned.
+func mkString(text string) *token {
+	return &token{typ: tokenString, text: text}
 }
 
 func mkAtom(text string) *token {
@@ -141,16 +206,27 @@ func (l *lexer) next() *token {
 			return mkToken(tokenRpar, ")")
 		case r == '.':
 			return mkToken(tokenDot, ".")
-		case r == '-' || r == '+':
-			if !isNumber(l.peek()) {
-				return mkToken(tokenChar, string(r))
-			}
+		case (r == '-' || r == '+') && isNumber(l.peek()):
+			// A sign followed by a digit starts a number. Otherwise
+			// it starts a symbol, such as + or -.
 			fallthrough
 		case isNumber(r):
 			return l.number(r)
 		case r == '\'':
 			return mkToken(tokenQuote, "'")
-		case r == '_' || unicode.IsLetter(r):
+		case r == '`':
+			return mkToken(tokenBackquote, "`")
+		case r == ',':
+			if l.peek() == '@' {
+				l.read()
+				return mkToken(tokenCommaAt, ",@")
+			}
+			return mkToken(tokenComma, ",")
+		case r == '"':
+			return l.string()
+		case r == '#' && isNumber(l.peek()):
+			return l.label()
+		case isSymbol(r):
 			return l.alphanum(typ, r)
 		default:
 			return mkToken(tokenChar, string(r))
@@ -195,9 +271,14 @@ func (l *lexer) back(r rune) {
 
 func (l *lexer) accum(r rune, valid func(rune) bool) {
 	l.buf.Reset()
+	l.buf.WriteRune(r)
+	l.more(valid)
+}
+
+// more adds the following valid runes to the buffer.
+func (l *lexer) more(valid func(rune) bool) {
 	for {
-		l.buf.WriteRune(r)
-		r = l.read()
+		r := l.read()
 		if r == EofRune {
 			return
 		}
@@ -205,6 +286,7 @@ func (l *lexer) accum(r rune, valid func(rune) bool) {
 			l.back(r)
 			return
 		}
+		l.buf.WriteRune(r)
 	}
 }
 
@@ -220,16 +302,91 @@ func isAlphanum(r rune) bool {
 	return r == '_' || isNumber(r) || unicode.IsLetter(r)
 }
 
+// isSymbol reports whether the rune can appear in a symbol (identifier).
+// As well as letters and digits, symbols can contain operator characters,
+// as in +, <=, and macroexpand-1. A symbol cannot start with a digit,
+// or with a sign followed by a digit; that is a number.
+func isSymbol(r rune) bool {
+	return isAlphanum(r) || strings.ContainsRune("+-*/<=>!?$%&^~:@", r)
+}
+
+// number lexes an integer, a rational such as 1/3, or a floating-point
+// number such as 3.14 or 1e-9.
 func (l *lexer) number(r rune) *token {
-	// Integer only for now.
 	l.accum(r, isNumber)
+	if l.peek() == '/' {
+		l.buf.WriteRune(l.read())
+		if !isNumber(l.peek()) {
+			errorf("bad number syntax: %s", &l.buf)
+		}
+		l.more(isNumber)
+		l.endToken()
+		return mkRat(l.buf.String())
+	}
+	float := false
+	if l.peek() == '.' {
+		float = true
+		l.buf.WriteRune(l.read())
+		l.more(isNumber)
+	}
+	if r := l.peek(); r == 'e' || r == 'E' {
+		float = true
+		l.buf.WriteRune(l.read())
+		if r := l.peek(); r == '+' || r == '-' {
+			l.buf.WriteRune(l.read())
+		}
+		l.more(isNumber)
+	}
 	l.endToken()
+	if float {
+		return mkFloat(l.buf.String(), l.prec)
+	}
 	return mkToken(tokenNumber, l.buf.String())
 }
 
+// string lexes a double-quoted string literal, which may contain the
+// escapes of a Go string literal. The opening quote has been consumed.
+func (l *lexer) string() *token {
+	l.buf.Reset()
+	l.buf.WriteRune('"')
+	for {
+		r := l.read()
+		switch r {
+		case EofRune, '\n':
+			errorf("unterminated string: %s", &l.buf)
+		case '\\':
+			l.buf.WriteRune(r)
+			r = l.read()
+		case '"':
+			l.buf.WriteRune(r)
+			l.endToken()
+			text, err := strconv.Unquote(l.buf.String())
+			if err != nil {
+				errorf("bad string syntax: %s", &l.buf)
+			}
+			return mkString(text)
+		}
+		l.buf.WriteRune(r)
+	}
+}
+
+// label lexes #n= or #n#, the notation for shared structure.
+// The # has been consumed. The text of the token is n.
+func (l *lexer) label() *token {
+	l.accum(l.read(), isNumber)
+	switch l.read() {
+	case '=':
+		return &token{typ: tokenLabel, text: l.buf.String()}
+	case '#':
+		return &token{typ: tokenLabelRef, text: l.buf.String()}
+	}
+	errorf("bad label syntax: #%s", &l.buf)
+	return nil
+}
+
 func (l *lexer) alphanum(typ TokType, r rune) *token {
 	// TODO: ASCII only for now.
-	l.accum(r, isAlphanum)
+	l.accum(r, isSymbol)
 	l.endToken()
 	return mkToken(typ, l.buf.String())
 }
@@ -248,29 +405,157 @@ var (
 	tokNil = mkToken(tokenConst, "nil")
 
 	// Pre-defined elementary functions and symbols.
-	tokAdd         = mkAtom("add")
-	tokAnd         = mkAtom("and")
-	tokApply       = mkAtom("apply")
-	tokAtom        = mkAtom("atom")
-	tokCar         = mkAtom("car")
-	tokCdr         = mkAtom("cdr")
-	tokCond        = mkAtom("cond")
-	tokCons        = mkAtom("cons")
-	tokDefn        = mkAtom("defn")
-	tokDiv         = mkAtom("div")
-	tokEq          = mkAtom("eq")
-	tokGe          = mkAtom("ge")
-	tokASCIILambda = mkAtom("lambda")
-	tokGt          = mkAtom("gt")
-	tokLambda      = mkAtom("λ")
-	tokLe          = mkAtom("le")
-	tokList        = mkAtom("list")
-	tokLt          = mkAtom("lt")
-	tokMul         = mkAtom("mul")
-	tokNe          = mkAtom("ne")
-	tokOr          = mkAtom("or")
-	tokNull        = mkAtom("null")
-	tokQuote       = mkAtom("quote")
-	tokRem         = mkAtom("rem")
-	tokSub         = mkAtom("sub")
+	tokAbs             = mkAtom("abs")
+	tokAdd             = mkAtom("add")
+	tokAnd             = mkAtom("and")
+	tokAppend          = mkAtom("append")
+	tokApply           = mkAtom("apply")
+	tokAref            = mkAtom("aref")
+	tokArgs            = mkAtom("args")
+	tokArray           = mkAtom("array")
+	tokArrayLength     = mkAtom("array-length")
+	tokArrayp          = mkAtom("arrayp")
+	tokAset            = mkAtom("aset")
+	tokAssoc           = mkAtom("assoc")
+	tokAtom            = mkAtom("atom")
+	tokAttrib          = mkAtom("attrib")
+	tokCar             = mkAtom("car")
+	tokCdr             = mkAtom("cdr")
+	tokClose           = mkAtom("close")
+	tokConcat          = mkAtom("concat")
+	tokCond            = mkAtom("cond")
+	tokCons            = mkAtom("cons")
+	tokDefmacro        = mkAtom("defmacro")
+	tokDefn            = mkAtom("defn")
+	tokDeflist         = mkAtom("deflist")
+	tokDenominator     = mkAtom("denominator")
+	tokDiv             = mkAtom("div")
+	tokDivide          = mkAtom("/")
+	tokElapsed         = mkAtom("elapsed")
+	tokEq              = mkAtom("eq")
+	tokEqual           = mkAtom("equal")
+	tokEval            = mkAtom("eval")
+	tokEvenp           = mkAtom("evenp")
+	tokExit            = mkAtom("exit")
+	tokExplode         = mkAtom("explode")
+	tokExpt            = mkAtom("expt")
+	tokFexpr           = mkAtom("fexpr")
+	tokFunction        = mkAtom("function")
+	tokGcd             = mkAtom("gcd")
+	tokGe              = mkAtom("ge")
+	tokGensym          = mkAtom("gensym")
+	tokGet             = mkAtom("get")
+	tokGetenv          = mkAtom("getenv")
+	tokGethash         = mkAtom("gethash")
+	tokGo              = mkAtom("go")
+	tokASCIILambda     = mkAtom("lambda")
+	tokGreater         = mkAtom(">")
+	tokGreaterEq       = mkAtom(">=")
+	tokGt              = mkAtom("gt")
+	tokHashCount       = mkAtom("hash-count")
+	tokImplode         = mkAtom("implode")
+	tokInput           = mkAtom("input")
+	tokIsqrt           = mkAtom("isqrt")
+	tokLabel           = mkAtom("label")
+	tokLambda          = mkAtom("λ")
+	tokLast            = mkAtom("last")
+	tokLcm             = mkAtom("lcm")
+	tokLe              = mkAtom("le")
+	tokLeftshift       = mkAtom("leftshift")
+	tokLength          = mkAtom("length")
+	tokLess            = mkAtom("<")
+	tokLessEq          = mkAtom("<=")
+	tokList            = mkAtom("list")
+	tokLoad            = mkAtom("load")
+	tokLogand          = mkAtom("logand")
+	tokLogor           = mkAtom("logor")
+	tokLogxor          = mkAtom("logxor")
+	tokLt              = mkAtom("lt")
+	tokMacro           = mkAtom("macro")
+	tokMacroexpand     = mkAtom("macroexpand")
+	tokMacroexpand1    = mkAtom("macroexpand-1")
+	tokMakeHashTable   = mkAtom("make-hash-table")
+	tokMakeVector      = mkAtom("make-vector")
+	tokMap             = mkAtom("map")
+	tokMapcar          = mkAtom("mapcar")
+	tokMapcon          = mkAtom("mapcon")
+	tokMaphash         = mkAtom("maphash")
+	tokMaplist         = mkAtom("maplist")
+	tokMax             = mkAtom("max")
+	tokMember          = mkAtom("member")
+	tokMin             = mkAtom("min")
+	tokMinus           = mkAtom("-")
+	tokMinusp          = mkAtom("minusp")
+	tokMul             = mkAtom("mul")
+	tokNconc           = mkAtom("nconc")
+	tokNe              = mkAtom("ne")
+	tokNegate          = mkAtom("negate")
+	tokNotEq           = mkAtom("/=")
+	tokNreverse        = mkAtom("nreverse")
+	tokNth             = mkAtom("nth")
+	tokNumberp         = mkAtom("numberp")
+	tokNumEq           = mkAtom("=")
+	tokOddp            = mkAtom("oddp")
+	tokOnep            = mkAtom("onep")
+	tokOpen            = mkAtom("open")
+	tokOr              = mkAtom("or")
+	tokNull            = mkAtom("null")
+	tokNumberToString  = mkAtom("number-to-string")
+	tokNumerator       = mkAtom("numerator")
+	tokOutput          = mkAtom("output")
+	tokPack            = mkAtom("pack")
+	tokPair            = mkAtom("pair")
+	tokPlist           = mkAtom("plist")
+	tokPlus            = mkAtom("+")
+	tokPrin1           = mkAtom("prin1")
+	tokPrinc           = mkAtom("princ")
+	tokPrint           = mkAtom("print")
+	tokProg            = mkAtom("prog")
+	tokProvide         = mkAtom("provide")
+	tokPut             = mkAtom("put")
+	tokPuthash         = mkAtom("puthash")
+	tokPutprop         = mkAtom("putprop")
+	tokQuasiquote      = mkAtom("quasiquote")
+	tokQuote           = mkAtom("quote")
+	tokQuotient        = mkAtom("quotient")
+	tokRead            = mkAtom("read")
+	tokReadChar        = mkAtom("read-char")
+	tokReadLine        = mkAtom("read-line")
+	tokRem             = mkAtom("rem")
+	tokRemhash         = mkAtom("remhash")
+	tokRemprop         = mkAtom("remprop")
+	tokRequire         = mkAtom("require")
+	tokReturn          = mkAtom("return")
+	tokReverse         = mkAtom("reverse")
+	tokRplaca          = mkAtom("rplaca")
+	tokRplacd          = mkAtom("rplacd")
+	tokSearch          = mkAtom("search")
+	tokSet             = mkAtom("set")
+	tokSetq            = mkAtom("setq")
+	tokSleep           = mkAtom("sleep")
+	tokSqrt            = mkAtom("sqrt")
+	tokStreamp         = mkAtom("streamp")
+	tokStringDowncase  = mkAtom("string-downcase")
+	tokStringEq        = mkAtom("string=")
+	tokStringIndex     = mkAtom("string-index")
+	tokStringLength    = mkAtom("string-length")
+	tokStringLt        = mkAtom("string<")
+	tokStringp         = mkAtom("stringp")
+	tokStringToNumber  = mkAtom("string-to-number")
+	tokStringToSymbol  = mkAtom("string-to-symbol")
+	tokStringUpcase    = mkAtom("string-upcase")
+	tokSub             = mkAtom("sub")
+	tokSublis          = mkAtom("sublis")
+	tokSubst           = mkAtom("subst")
+	tokSubstring       = mkAtom("substring")
+	tokSymbolToString  = mkAtom("symbol-to-string")
+	tokTerpri          = mkAtom("terpri")
+	tokTime            = mkAtom("time")
+	tokTimes           = mkAtom("*")
+	tokUnpack          = mkAtom("unpack")
+	tokUnquote         = mkAtom("unquote")
+	tokUnquoteSplicing = mkAtom("unquote-splicing")
+	tokWithOpenFile    = mkAtom("with-open-file")
+	tokWriteString     = mkAtom("write-string")
+	tokZerop           = mkAtom("zerop")
 )
@@ -0,0 +1,284 @@
+// Copyright 2020 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// This file contains native implementations of the list functions of
+// the Lisp 1.5 book. Unlike the elementary functions, they are found only
+// if the atom has no value, so a user's defn can replace them. They loop
+// rather than recur, so long lists do not use up the call depth.
+
+package lisp1_5
+
+var library funcMap
+
+func libraryInit() {
+	if library == nil {
+		library = funcMap{
+			tokAppend:  (*Context).appendFunc,
+			tokAssoc:   (*Context).assocFunc,
+			tokEqual:   (*Context).equalFunc,
+			tokLast:    (*Context).lastFunc,
+			tokLength:  (*Context).lengthFunc,
+			tokMap:     (*Context).mapFunc,
+			tokMapcar:  (*Context).mapcarFunc,
+			tokMapcon:  (*Context).mapconFunc,
+			tokMaplist: (*Context).maplistFunc,
+			tokMember:  (*Context).memberFunc,
+			tokNth:     (*Context).nthFunc,
+			tokPair:    (*Context).pairFunc,
+			tokReverse: (*Context).reverseFunc,
+			tokSearch:  (*Context).searchFunc,
+			tokSublis:  (*Context).sublisFunc,
+			tokSubst:   (*Context).substFunc,
+		}
+	}
+}
+
+// args checks that the argument list has n elements and returns them.
+func args(name *token, expr *Expr, n int) []*Expr {
+	a := slice(expr)
+	if len(a) != n {
+		errorf("%s: expect %d arguments; have %d", name, n, len(a))
+	}
+	return a
+}
+
+// getList checks that the expression is a list, possibly empty, and returns it.
+func getList(name *token, expr *Expr) *Expr {
+	if expr != nil && expr.atom != nil {
+		errorf("%s: expect list; have %s", name, expr)
+	}
+	return expr
+}
+
+// listBuilder builds a list by appending to its end.
+type listBuilder struct {
+	head, tail *Expr
+}
+
+func (b *listBuilder) add(e *Expr) {
+	cell := Cons(e, nil)
+	if b.tail == nil {
+		b.head = cell
+	} else {
+		b.tail.cdr = cell
+	}
+	b.tail = cell
+}
+
+// (append x...) returns the concatenation of the lists. All but the
+// last are copied.
+func (c *Context) appendFunc(name *token, expr *Expr) *Expr {
+	var b listBuilder
+	for ; expr != nil; expr = Cdr(expr) {
+		if Cdr(expr) == nil {
+			if b.tail == nil {
+				return Car(expr)
+			}
+			b.tail.cdr = Car(expr)
+			break
+		}
+		for l := getList(name, Car(expr)); l != nil; l = getList(name, l.cdr) {
+			b.add(l.car)
+		}
+	}
+	return b.head
+}
+
+// (reverse l) returns a reversed copy of the list.
+func (c *Context) reverseFunc(name *token, expr *Expr) *Expr {
+	var result *Expr
+	for l := getList(name, args(name, expr, 1)[0]); l != nil; l = getList(name, l.cdr) {
+		result = Cons(l.car, result)
+	}
+	return result
+}
+
+// (length l) returns the number of elements in the list.
+func (c *Context) lengthFunc(name *token, expr *Expr) *Expr {
+	n := 0
+	for l := getList(name, args(name, expr, 1)[0]); l != nil; l = getList(name, l.cdr) {
+		n++
+	}
+	return intExpr(n)
+}
+
+// The mapping functions take the function first and the list second,
+// the order of mapcar in the original library, and not the book's order
+// for maplist, mapcon, and map, so that all four agree. The formulas
+// below are the book's, rewritten for that order.
+
+// (maplist f x) returns the list of f applied to x and to each
+// successive cdr of x.
+//
+//	maplist[f;x] = [null[x] → NIL; T → cons[f[x];maplist[f;cdr[x]]]]
+func (c *Context) maplistFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 2)
+	var b listBuilder
+	for l := getList(name, a[1]); l != nil; l = getList(name, l.cdr) {
+		b.add(c.apply(name.text, a[0], Cons(l, nil)))
+	}
+	return b.head
+}
+
+// (mapcon f x) is like maplist but joins the results, which must be
+// lists, with nconc.
+//
+//	mapcon[f;x] = [null[x] → NIL; T → nconc[f[x];mapcon[f;cdr[x]]]]
+func (c *Context) mapconFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 2)
+	var results []*Expr
+	for l := getList(name, a[1]); l != nil; l = getList(name, l.cdr) {
+		results = append(results, c.apply(name.text, a[0], Cons(l, nil)))
+	}
+	var list *Expr
+	for i := len(results) - 1; i >= 0; i-- {
+		list = Cons(results[i], list)
+	}
+	return c.nconcFunc(tokNconc, list)
+}
+
+// (map f x) applies f to x and to each successive cdr of x, and returns nil.
+func (c *Context) mapFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 2)
+	for l := getList(name, a[1]); l != nil; l = getList(name, l.cdr) {
+		c.apply(name.text, a[0], Cons(l, nil))
+	}
+	return nil
+}
+
+// (mapcar fn l) returns the list of fn applied to each element of l.
+func (c *Context) mapcarFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 2)
+	var b listBuilder
+	for l := getList(name, a[1]); l != nil; l = getList(name, l.cdr) {
+		b.add(c.apply(name.text, a[0], Cons(l.car, nil)))
+	}
+	return b.head
+}
+
+// (search x p f u) finds the first cdr of x, including x itself,
+// that satisfies p, and returns f of it. If there is none, it returns u of nil.
+//
+//	search[x;p;f;u] = [null[x] → u[x]; p[x] → f[x]; T → search[cdr[x];p;f;u]]
+func (c *Context) searchFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 4)
+	l := getList(name, a[0])
+	for ; l != nil; l = getList(name, l.cdr) {
+		if c.apply(name.text, a[1], Cons(l, nil)).isTrue() {
+			return c.apply(name.text, a[2], Cons(l, nil))
+		}
+	}
+	return c.apply(name.text, a[3], Cons(nil, nil))
+}
+
+// (subst x y z) returns a copy of z with every subexpression equal to y
+// replaced by x.
+func (c *Context) substFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 3)
+	return subst(a[0], a[1], a[2])
+}
+
+// subst[x;y;z] = [equal[y;z] → x;
+//
+//	atom[z] → z;
+//	T → cons[subst[x;y;car[z]];subst[x;y;cdr[z]]]]
+func subst(x, y, z *Expr) *Expr {
+	switch {
+	case equal(y, z):
+		return x
+	case z == nil || z.atom != nil:
+		return z
+	}
+	return Cons(subst(x, y, z.car), subst(x, y, z.cdr))
+}
+
+// (sublis a y) returns a copy of y with each atom that is the car of a
+// pair on the list a replaced by the cdr of the pair.
+func (c *Context) sublisFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 2)
+	return sublis(getList(name, a[0]), a[1])
+}
+
+// sublis[x;y] = [atom[y] → sub2[x;y];
+//
+//	T → cons[sublis[x;car[y]];sublis[x;cdr[y]]]]
+func sublis(x, y *Expr) *Expr {
+	if y == nil || y.atom != nil {
+		if pair := assoc(y, x); pair != nil {
+			return Cdr(pair)
+		}
+		return y
+	}
+	return Cons(sublis(x, y.car), sublis(x, y.cdr))
+}
+
+// (pair x y) returns the list of pairs of corresponding elements of the
+// lists, which must be the same length.
+func (c *Context) pairFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 2)
+	var b listBuilder
+	x, y := getList(name, a[0]), getList(name, a[1])
+	for ; x != nil && y != nil; x, y = getList(name, x.cdr), getList(name, y.cdr) {
+		b.add(Cons(x.car, y.car))
+	}
+	if x != nil || y != nil {
+		errorf("%s: lists of different lengths", name)
+	}
+	return b.head
+}
+
+// (assoc x a) returns the first pair on the list a whose car is equal to x, or nil.
+func (c *Context) assocFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 2)
+	for l := getList(name, a[1]); l != nil; l = getList(name, l.cdr) {
+		if equal(Car(l.car), a[0]) {
+			return l.car
+		}
+	}
+	return nil
+}
+
+// (equal x y) reports whether x and y have the same structure and eq atoms.
+//
+//	equal[x;y] = [atom[x] → [atom[y] → eq[x;y]; T → F];
+//		equal[car[x];car[y]] → equal[cdr[x];cdr[y]]; T → F]
+func (c *Context) equalFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 2)
+	return truthExpr(equal(a[0], a[1]))
+}
+
+// (member x l) reports whether an element of the list is equal to x.
+func (c *Context) memberFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 2)
+	for l := getList(name, a[1]); l != nil; l = getList(name, l.cdr) {
+		if equal(l.car, a[0]) {
+			return truthExpr(true)
+		}
+	}
+	return truthExpr(false)
+}
+
+// (last l) returns the last cons of the list, or nil if it is empty.
+func (c *Context) lastFunc(name *token, expr *Expr) *Expr {
+	l := getList(name, args(name, expr, 1)[0])
+	for l != nil && l.cdr != nil && l.cdr.atom == nil {
+		l = l.cdr
+	}
+	return l
+}
+
+// (nth n l) returns element n of the list, counting from 0, or nil if
+// the list is too short.
+func (c *Context) nthFunc(name *token, expr *Expr) *Expr {
+	a := args(name, expr, 2)
+	n := c.getInt(a[0])
+	if n < 0 {
+		errorf("%s: negative index %d", name, n)
+	}
+	l := getList(name, a[1])
+	for ; l != nil && n > 0; n-- {
+		l = getList(name, l.cdr)
+	}
+	return Car(l)
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// This file contains the implementation of loading source files and
+// of modules. A module is a file, name.lisp, found in a directory on
+// the library path. (require 'name) loads it unless it has already
+// been loaded or provided, and (provide 'name) marks it as provided,
+// so each module is loaded at most once however many files require it.
+
+package lisp1_5
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// prelude is the standard library, which NewContext loads.
+//
+//go:embed prelude.lisp
+var prelude string
+
+// Prelude returns an Option that sets whether NewContext loads the prelude,
+// the standard library of functions and macros written in Lisp, such as
+// equal, not, sort, and let. The default is to load it.
+func Prelude(on bool) Option {
+	return func(c *Context) {
+		c.noPrelude = !on
+	}
+}
+
+// loadPrelude loads the prelude. It always uses the default evaluator,
+// since the a-list evaluator cannot define macros.
+func (c *Context) loadPrelude() {
+	alist := c.alist
+	c.alist = false
+	defer func() { c.alist = alist }()
+	if err := c.load("prelude", strings.NewReader(prelude)); err != nil {
+		panic(err) // A bug in the prelude.
+	}
+}
+
+// LibraryPath returns an Option that sets the directories that require
+// searches, in order, for modules. The default is the current directory.
+func LibraryPath(dirs []string) Option {
+	return func(c *Context) {
+		c.libPath = dirs
+	}
+}
+
+// Load reads the named source file and evaluates the expressions in it,
+// in order. It stops at the first error, which it returns; if the error
+// is in evaluation, it has type Error and the stack is restored to its
+// state when Load was called.
+func (c *Context) Load(path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return c.load(path, bufio.NewReader(fd))
+}
+
+// load evaluates the expressions read from r, as described in Load.
+// The name identifies the source in errors.
+func (c *Context) load(name string, r io.RuneReader) (err error) {
+	depth, stackDepth, a := len(c.scope), c.stackDepth, c.a
+	defer func() {
+		e := recover()
+		if e == nil {
+			return
+		}
+		msg, ok := e.(Error)
+		if !ok {
+			panic(e)
+		}
+		for len(c.scope) > depth {
+			c.pop()
+		}
+		c.stackDepth, c.a = stackDepth, a
+		err = Error(fmt.Sprintf("%s: %s", name, msg))
+	}()
+	p := c.newParser(r)
+	for {
+		switch p.SkipSpace() {
+		case '\n':
+			continue
+		case EofRune:
+			return nil
+		}
+		c.Eval(p.List())
+	}
+}
+
+// (load file) loads the named source file, and returns T.
+func (c *Context) loadFunc(name *token, expr *Expr) *Expr {
+	if err := c.Load(getString(Car(expr))); err != nil {
+		errorf("%s: %v", name, err)
+	}
+	return constT
+}
+
+// moduleName returns the name of the module represented by the expression,
+// which is an atom or a string.
+func moduleName(name *token, expr *Expr) string {
+	atom := expr.getAtom()
+	if atom == nil || (atom.typ != tokenAtom && atom.typ != tokenString) {
+		errorf("%s: bad module name %s", name, expr)
+	}
+	return atom.text
+}
+
+// (provide module) records that the module has been loaded,
+// and returns the module.
+func (c *Context) provideFunc(name *token, expr *Expr) *Expr {
+	c.modules[moduleName(name, Car(expr))] = true
+	return Car(expr)
+}
+
+// (require module) loads the module from the first directory on the
+// library path that holds it, unless it has been loaded already. It returns
+// T if it loaded the module, F if not.
+func (c *Context) requireFunc(name *token, expr *Expr) *Expr {
+	module := moduleName(name, Car(expr))
+	if c.modules[module] {
+		return constF
+	}
+	for _, dir := range c.libPath {
+		path := filepath.Join(dir, module+".lisp")
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		c.modules[module] = true // Before loading, so a cycle of requires ends.
+		if err := c.Load(path); err != nil {
+			delete(c.modules, module)
+			errorf("%s: %v", name, err)
+		}
+		return constT
+	}
+	errorf("%s: module %s not found in %q", name, module, c.libPath)
+	return nil
+}
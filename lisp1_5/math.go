@@ -9,60 +9,678 @@ package lisp1_5
 
 import (
 	"math/big"
+	"strings"
 )
 
+// Numbers are integers, held in a big.Int, rationals, held in a big.Rat,
+// or floating-point numbers, held in a big.Float. When an operation mixes
+// kinds, the operands are promoted to the higher kind: integer to rational
+// to float. A rational whose denominator is 1 becomes an integer.
+// Comparisons, however, are exact: 0.1 is not eq to 1/10.
+
+// defaultFloatPrec is the default precision, in bits, of floating-point
+// numbers: that of a float64.
+const defaultFloatPrec = 53
+
+// FloatPrecision returns an Option that sets the precision, in bits, of the
+// floating-point numbers the Context computes, and that it reads with load,
+// with read from a stream, and from the parser set by Input. The default,
+// also used if prec is 0, is 53, the precision of a float64.
+func FloatPrecision(prec uint) Option {
+	return func(c *Context) {
+		if prec == 0 {
+			prec = defaultFloatPrec
+		}
+		c.floatPrec = prec
+	}
+}
+
+// newFloat returns a zero float with the context's precision.
+func (c *Context) newFloat() *big.Float {
+	return new(big.Float).SetPrec(c.floatPrec)
+}
+
+// Kinds of number, in order of promotion.
+const (
+	intKind = iota
+	ratKind
+	floatKind
+)
+
+func numKind(t *token) int {
+	switch {
+	case t.flt != nil:
+		return floatKind
+	case t.rat != nil:
+		return ratKind
+	}
+	return intKind
+}
+
+// toRat returns the value of the number, which must not be a float, as a rational.
+func toRat(t *token) *big.Rat {
+	if t.rat != nil {
+		return t.rat
+	}
+	return new(big.Rat).SetInt(t.num)
+}
+
+// toFloat returns the value of the number as a new float with the
+// context's precision.
+func (c *Context) toFloat(t *token) *big.Float {
+	switch numKind(t) {
+	case floatKind:
+		return c.newFloat().Set(t.flt)
+	case ratKind:
+		return c.newFloat().SetRat(t.rat)
+	}
+	return c.newFloat().SetInt(t.num)
+}
+
+// formatFloat returns the printed form of a float, which always
+// contains a decimal point or exponent so it reads back as a float.
+func formatFloat(f *big.Float) string {
+	s := f.Text('g', -1)
+	if !strings.ContainsAny(s, ".eI") {
+		s += ".0"
+	}
+	return s
+}
+
 // Arithmetic.
 
-func (c *Context) mathFunc(expr *Expr, fn func(*big.Int, *big.Int) *big.Int) *Expr {
-	return atomExpr(number(fn(c.getNumber(Car(expr)), c.getNumber(Car(Cdr(expr))))))
+// A mathOp holds the implementations of an operator for each kind of number.
+// If int is nil, integer operands are promoted to rationals.
+type mathOp struct {
+	int   func(*big.Int, *big.Int) *big.Int
+	rat   func(*big.Rat, *big.Rat) *big.Rat
+	float func(*big.Float, *big.Float) *big.Float
+}
+
+func (c *Context) mathFunc(name *token, expr *Expr, op mathOp) *Expr {
+	binary(name, expr)
+	return c.mathOp(Car(expr), Car(Cdr(expr)), op)
+}
+
+// mathOp applies the operator to two numbers.
+func (c *Context) mathOp(x, y *Expr, op mathOp) *Expr {
+	defer nanError()
+	a, b := c.getNumber(x), c.getNumber(y)
+	kind := max(numKind(a), numKind(b))
+	if kind == intKind && op.int == nil {
+		kind = ratKind
+	}
+	switch kind {
+	case floatKind:
+		return atomExpr(floatNumber(op.float(c.toFloat(a), c.toFloat(b))))
+	case ratKind:
+		return atomExpr(ratNumber(op.rat(toRat(a), toRat(b))))
+	}
+	return atomExpr(number(op.int(a.num, b.num)))
+}
+
+// nanError turns the panic big.Float raises for an operation whose
+// result would be NaN, such as subtracting infinities, into an Error.
+// It must be deferred.
+func nanError() {
+	if e := recover(); e != nil {
+		if nan, ok := e.(big.ErrNaN); ok {
+			errorf("%s", nan.Error())
+		}
+		panic(e)
+	}
+}
+
+// binary checks that a function has been given exactly two arguments.
+func binary(name *token, expr *Expr) {
+	if n := expr.length(); n != 2 {
+		errorf("%s: expect 2 arguments; have %d", name, n)
+	}
 }
 
-func (c *Context) getNumber(expr *Expr) *big.Int {
+func (c *Context) getNumber(expr *Expr) *token {
 	if !expr.isNumber() {
 		errorf("expect number; have %s", expr)
 	}
-	return expr.atom.num
+	return expr.atom
+}
+
+func intExpr(i int) *Expr {
+	return atomExpr(number(big.NewInt(int64(i))))
+}
+
+// getInt returns the value of the expression, which must be an integer
+// small enough to index a Go slice.
+func (c *Context) getInt(expr *Expr) int {
+	t := c.getNumber(expr)
+	if numKind(t) != intKind || !t.num.IsInt64() {
+		errorf("expect integer; have %s", expr)
+	}
+	return int(t.num.Int64())
 }
 
 func add(a, b *big.Int) *big.Int { return new(big.Int).Add(a, b) }
-func div(a, b *big.Int) *big.Int {
-	if b.Cmp(&zero) == 0 {
+func mul(a, b *big.Int) *big.Int { return new(big.Int).Mul(a, b) }
+func quo(a, b *big.Int) *big.Int {
+	if b.Sign() == 0 {
 		errorf("division by zero")
 	}
-	return new(big.Int).Div(a, b)
+	return new(big.Int).Quo(a, b)
 }
-func mul(a, b *big.Int) *big.Int { return new(big.Int).Mul(a, b) }
 func rem(a, b *big.Int) *big.Int {
-	if b.Cmp(&zero) == 0 {
+	if b.Sign() == 0 {
 		errorf("rem by zero")
 	}
 	return new(big.Int).Rem(a, b)
 }
 func sub(a, b *big.Int) *big.Int { return new(big.Int).Sub(a, b) }
 
-func (c *Context) addFunc(name *token, expr *Expr) *Expr { return c.mathFunc(expr, add) }
-func (c *Context) divFunc(name *token, expr *Expr) *Expr { return c.mathFunc(expr, div) }
-func (c *Context) mulFunc(name *token, expr *Expr) *Expr { return c.mathFunc(expr, mul) }
-func (c *Context) remFunc(name *token, expr *Expr) *Expr { return c.mathFunc(expr, rem) }
-func (c *Context) subFunc(name *token, expr *Expr) *Expr { return c.mathFunc(expr, sub) }
+func radd(a, b *big.Rat) *big.Rat { return new(big.Rat).Add(a, b) }
+func rdiv(a, b *big.Rat) *big.Rat {
+	if b.Sign() == 0 {
+		errorf("division by zero")
+	}
+	return new(big.Rat).Quo(a, b)
+}
+func rmul(a, b *big.Rat) *big.Rat { return new(big.Rat).Mul(a, b) }
+func rquo(a, b *big.Rat) *big.Rat {
+	q := rdiv(a, b)
+	return new(big.Rat).SetInt(new(big.Int).Quo(q.Num(), q.Denom()))
+}
+func rrem(a, b *big.Rat) *big.Rat {
+	if b.Sign() == 0 {
+		errorf("rem by zero")
+	}
+	// The result has the sign of a, as with big.Int.Rem.
+	return new(big.Rat).Sub(a, new(big.Rat).Mul(b, rquo(a, b)))
+}
+func rsub(a, b *big.Rat) *big.Rat { return new(big.Rat).Sub(a, b) }
+
+// The float operations leave the precision of the result zero, so it becomes
+// that of the operands.
+
+func fadd(a, b *big.Float) *big.Float { return new(big.Float).Add(a, b) }
+func fdiv(a, b *big.Float) *big.Float {
+	if b.Sign() == 0 {
+		errorf("division by zero")
+	}
+	return new(big.Float).Quo(a, b)
+}
+func fmul(a, b *big.Float) *big.Float { return new(big.Float).Mul(a, b) }
+func fquo(a, b *big.Float) *big.Float {
+	q, _ := fdiv(a, b).Int(nil)
+	return new(big.Float).SetPrec(max(a.Prec(), b.Prec())).SetInt(q)
+}
+func frem(a, b *big.Float) *big.Float {
+	if b.Sign() == 0 {
+		errorf("rem by zero")
+	}
+	return new(big.Float).Sub(a, new(big.Float).Mul(b, fquo(a, b)))
+}
+func fsub(a, b *big.Float) *big.Float { return new(big.Float).Sub(a, b) }
+
+// Division of integers is exact, so div has no integer implementation.
+// Quotient truncates toward zero, as div did before there were rationals;
+// for any numbers a and b, a = (add (mul b (quotient a b)) (rem a b)).
+var (
+	addOp      = mathOp{add, radd, fadd}
+	divOp      = mathOp{nil, rdiv, fdiv}
+	mulOp      = mathOp{mul, rmul, fmul}
+	quotientOp = mathOp{quo, rquo, fquo}
+	remOp      = mathOp{rem, rrem, frem}
+	subOp      = mathOp{sub, rsub, fsub}
+)
+
+func (c *Context) addFunc(name *token, expr *Expr) *Expr { return c.mathFunc(name, expr, addOp) }
+func (c *Context) divFunc(name *token, expr *Expr) *Expr { return c.mathFunc(name, expr, divOp) }
+func (c *Context) mulFunc(name *token, expr *Expr) *Expr { return c.mathFunc(name, expr, mulOp) }
+func (c *Context) quotientFunc(name *token, expr *Expr) *Expr {
+	return c.mathFunc(name, expr, quotientOp)
+}
+func (c *Context) remFunc(name *token, expr *Expr) *Expr { return c.mathFunc(name, expr, remOp) }
+func (c *Context) subFunc(name *token, expr *Expr) *Expr { return c.mathFunc(name, expr, subOp) }
+
+// The operators + - * / take any number of arguments, as in other Lisps.
+// (+) is 0 and (*) is 1; (- x) is the negation of x and (/ x) its reciprocal.
+
+func (c *Context) plusFunc(name *token, expr *Expr) *Expr {
+	return c.fold(expr, intExpr(0), addOp)
+}
+
+func (c *Context) timesFunc(name *token, expr *Expr) *Expr {
+	return c.fold(expr, intExpr(1), mulOp)
+}
+
+func (c *Context) minusFunc(name *token, expr *Expr) *Expr {
+	if expr == nil {
+		errorf("%s: expect at least 1 argument", name)
+	}
+	if Cdr(expr) == nil {
+		return c.mathOp(intExpr(0), Car(expr), subOp)
+	}
+	return c.fold(Cdr(expr), Car(expr), subOp)
+}
+
+func (c *Context) divideFunc(name *token, expr *Expr) *Expr {
+	if expr == nil {
+		errorf("%s: expect at least 1 argument", name)
+	}
+	if Cdr(expr) == nil {
+		return c.mathOp(intExpr(1), Car(expr), divOp)
+	}
+	return c.fold(Cdr(expr), Car(expr), divOp)
+}
+
+// fold applies the operator to the accumulated result and each number in the list in turn.
+func (c *Context) fold(expr, result *Expr, op mathOp) *Expr {
+	for ; expr != nil; expr = Cdr(expr) {
+		result = c.mathOp(result, Car(expr), op)
+	}
+	return result
+}
+
+// (numerator x) and (denominator x) return the parts of a rational in lowest
+// terms. An integer is its own numerator, with denominator 1.
+
+func (c *Context) numeratorFunc(name *token, expr *Expr) *Expr {
+	return atomExpr(number(new(big.Int).Set(c.getRational(Car(expr)).Num())))
+}
+
+func (c *Context) denominatorFunc(name *token, expr *Expr) *Expr {
+	return atomExpr(number(new(big.Int).Set(c.getRational(Car(expr)).Denom())))
+}
+
+func (c *Context) getRational(expr *Expr) *big.Rat {
+	t := c.getNumber(expr)
+	if numKind(t) == floatKind {
+		errorf("expect rational; have %s", expr)
+	}
+	return toRat(t)
+}
 
 // Comparison.
 
-func (c *Context) boolFunc(expr *Expr, fn func(*big.Int, *big.Int) bool) *Expr {
-	return truthExpr(fn(c.getNumber(Car(expr)), c.getNumber(Car(Cdr(expr)))))
+func (c *Context) boolFunc(name *token, expr *Expr, fn func(int) bool) *Expr {
+	binary(name, expr)
+	return truthExpr(fn(numCmp(c.getNumber(Car(expr)), c.getNumber(Car(Cdr(expr))))))
 }
 
-func ge(a, b *big.Int) bool { return a.Cmp(b) >= 0 }
-func gt(a, b *big.Int) bool { return a.Cmp(b) > 0 }
-func le(a, b *big.Int) bool { return a.Cmp(b) <= 0 }
-func lt(a, b *big.Int) bool { return a.Cmp(b) < 0 }
-func ne(a, b *big.Int) bool { return a.Cmp(b) != 0 }
+// chain reports whether fn holds for each adjacent pair of numbers in the list,
+// so (< a b c) means a < b and b < c.
+func (c *Context) chain(name *token, expr *Expr, fn func(int) bool) *Expr {
+	if expr == nil {
+		errorf("%s: expect at least 1 argument", name)
+	}
+	a := c.getNumber(Car(expr))
+	ok := true
+	for expr = Cdr(expr); expr != nil; expr = Cdr(expr) {
+		b := c.getNumber(Car(expr))
+		ok = ok && fn(numCmp(a, b))
+		a = b
+	}
+	return truthExpr(ok)
+}
+
+// numCmp compares two numbers exactly, returning -1, 0, or +1.
+func numCmp(a, b *token) int {
+	switch max(numKind(a), numKind(b)) {
+	case floatKind:
+		switch {
+		case numKind(b) != floatKind:
+			return cmpFloatRat(a.flt, toRat(b))
+		case numKind(a) != floatKind:
+			return -cmpFloatRat(b.flt, toRat(a))
+		}
+		return a.flt.Cmp(b.flt)
+	case ratKind:
+		return toRat(a).Cmp(toRat(b))
+	}
+	return a.num.Cmp(b.num)
+}
+
+// cmpFloatRat compares f with the rational p/q exactly, by comparing f*q
+// with p. The product is computed with enough precision to be exact.
+func cmpFloatRat(f *big.Float, r *big.Rat) int {
+	q := new(big.Float).SetInt(r.Denom())
+	fq := new(big.Float).SetPrec(f.Prec()+q.Prec()).Mul(f, q)
+	return fq.Cmp(new(big.Float).SetInt(r.Num()))
+}
 
-func (c *Context) geFunc(name *token, expr *Expr) *Expr { return c.boolFunc(expr, ge) }
-func (c *Context) gtFunc(name *token, expr *Expr) *Expr { return c.boolFunc(expr, gt) }
-func (c *Context) leFunc(name *token, expr *Expr) *Expr { return c.boolFunc(expr, le) }
-func (c *Context) ltFunc(name *token, expr *Expr) *Expr { return c.boolFunc(expr, lt) }
-func (c *Context) neFunc(name *token, expr *Expr) *Expr { return c.boolFunc(expr, ne) }
+func eql(cmp int) bool { return cmp == 0 }
+func ge(cmp int) bool  { return cmp >= 0 }
+func gt(cmp int) bool  { return cmp > 0 }
+func le(cmp int) bool  { return cmp <= 0 }
+func lt(cmp int) bool  { return cmp < 0 }
+func ne(cmp int) bool  { return cmp != 0 }
+
+func (c *Context) geFunc(name *token, expr *Expr) *Expr { return c.boolFunc(name, expr, ge) }
+func (c *Context) gtFunc(name *token, expr *Expr) *Expr { return c.boolFunc(name, expr, gt) }
+func (c *Context) leFunc(name *token, expr *Expr) *Expr { return c.boolFunc(name, expr, le) }
+func (c *Context) ltFunc(name *token, expr *Expr) *Expr { return c.boolFunc(name, expr, lt) }
+func (c *Context) neFunc(name *token, expr *Expr) *Expr { return c.boolFunc(name, expr, ne) }
+
+// The operators = < <= > >= take one or more arguments and compare each
+// adjacent pair. /= reports whether no two of its arguments are equal.
+
+func (c *Context) numEqFunc(name *token, expr *Expr) *Expr     { return c.chain(name, expr, eql) }
+func (c *Context) lessFunc(name *token, expr *Expr) *Expr      { return c.chain(name, expr, lt) }
+func (c *Context) lessEqFunc(name *token, expr *Expr) *Expr    { return c.chain(name, expr, le) }
+func (c *Context) greaterFunc(name *token, expr *Expr) *Expr   { return c.chain(name, expr, gt) }
+func (c *Context) greaterEqFunc(name *token, expr *Expr) *Expr { return c.chain(name, expr, ge) }
+
+func (c *Context) notEqFunc(name *token, expr *Expr) *Expr {
+	if expr == nil {
+		errorf("%s: expect at least 1 argument", name)
+	}
+	nums := make([]*token, 0, expr.length())
+	for ; expr != nil; expr = Cdr(expr) {
+		nums = append(nums, c.getNumber(Car(expr)))
+	}
+	for i, a := range nums {
+		for _, b := range nums[i+1:] {
+			if numCmp(a, b) == 0 {
+				return truthExpr(false)
+			}
+		}
+	}
+	return truthExpr(true)
+}
+
+// Extended arithmetic.
+
+// getInteger returns the value of the expression, which must be an integer.
+func (c *Context) getInteger(expr *Expr) *big.Int {
+	t := c.getNumber(expr)
+	if numKind(t) != intKind {
+		errorf("expect integer; have %s", expr)
+	}
+	return t.num
+}
+
+// sign returns -1, 0, or +1 according to the sign of the number.
+func sign(t *token) int {
+	switch numKind(t) {
+	case floatKind:
+		return t.flt.Sign()
+	case ratKind:
+		return t.rat.Sign()
+	}
+	return t.num.Sign()
+}
+
+func negate(t *token) *token {
+	switch numKind(t) {
+	case floatKind:
+		return floatNumber(new(big.Float).Neg(t.flt))
+	case ratKind:
+		return ratNumber(new(big.Rat).Neg(t.rat))
+	}
+	return number(new(big.Int).Neg(t.num))
+}
+
+func (c *Context) negateFunc(name *token, expr *Expr) *Expr {
+	return atomExpr(negate(c.getNumber(Car(expr))))
+}
+
+func (c *Context) absFunc(name *token, expr *Expr) *Expr {
+	if t := c.getNumber(Car(expr)); sign(t) < 0 {
+		return atomExpr(negate(t))
+	}
+	return Car(expr)
+}
+
+// maxBits is the largest number of bits in an integer computed by expt
+// or leftshift. It stops a small expression from exhausting memory.
+const maxBits = 1 << 24
+
+// checkBits raises an error if x**n, for integers x and n, would have more
+// than maxBits bits.
+func checkBits(name *token, x, n *big.Int) {
+	b := int64(x.BitLen() - 1) // x**n has at least b*|n| bits.
+	if b <= 0 {
+		return
+	}
+	e := new(big.Int).Abs(n)
+	if !e.IsInt64() || e.Int64() > maxBits/b {
+		errorf("%s: result too large: %s to the power %s", name, x, n)
+	}
+}
+
+// (expt x n) returns x to the power n. If n is an integer the result is
+// exact, a rational if n is negative, unless x is a float. Otherwise it
+// is a float, computed at the floating-point precision.
+func (c *Context) exptFunc(name *token, expr *Expr) *Expr {
+	x, n := c.getNumber(Car(expr)), c.getNumber(Car(Cdr(expr)))
+	if numKind(n) != intKind {
+		nf := c.toFloat(n)
+		if nf.IsInt() {
+			i, _ := nf.Int(nil)
+			return atomExpr(floatNumber(floatPow(c.toFloat(x), i)))
+		}
+		if sign(x) < 0 {
+			errorf("%s: %s to the power %s is not a real number", name, Car(expr), Car(Cdr(expr)))
+		}
+		return atomExpr(floatNumber(realPow(c.toFloat(x), nf)))
+	}
+	switch {
+	case numKind(x) == floatKind:
+		return atomExpr(floatNumber(floatPow(c.toFloat(x), n.num)))
+	case numKind(x) == ratKind || n.num.Sign() < 0:
+		r := toRat(x)
+		checkBits(name, r.Num(), n.num)
+		checkBits(name, r.Denom(), n.num)
+		return atomExpr(ratNumber(ratPow(r, n.num)))
+	}
+	checkBits(name, x.num, n.num)
+	return atomExpr(number(new(big.Int).Exp(x.num, n.num, nil)))
+}
+
+func ratPow(x *big.Rat, n *big.Int) *big.Rat {
+	e := new(big.Int).Abs(n)
+	num := new(big.Int).Exp(x.Num(), e, nil)
+	den := new(big.Int).Exp(x.Denom(), e, nil)
+	if n.Sign() < 0 {
+		if num.Sign() == 0 {
+			errorf("division by zero")
+		}
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den)
+}
+
+// floatPow computes x**n by repeated squaring, at the precision of x.
+// It stops once the square is infinite, zero, or one, since further
+// squares cannot change the magnitude of the result except to overflow
+// or underflow, so a huge n costs no more than the exponent range of a
+// big.Float allows.
+func floatPow(x *big.Float, n *big.Int) *big.Float {
+	r := new(big.Float).SetPrec(x.Prec()).SetInt64(1)
+	sq := new(big.Float).Set(x)
+	e := new(big.Int).Abs(n)
+	for i := 0; i < e.BitLen(); i++ {
+		if e.Bit(i) == 1 {
+			r.Mul(r, sq)
+		}
+		if sq.IsInf() || sq.Sign() == 0 || sq.Cmp(floatOne) == 0 {
+			// Any higher bit of e would multiply r by sq again.
+			if i+1 < e.BitLen() && sq.Cmp(floatOne) != 0 {
+				r.Mul(r, sq)
+			}
+			break
+		}
+		sq.Mul(sq, sq)
+	}
+	if n.Sign() < 0 {
+		if r.Sign() == 0 {
+			errorf("division by zero")
+		}
+		r = new(big.Float).SetPrec(x.Prec()).Quo(floatOne, r)
+	}
+	return r
+}
+
+var floatOne = big.NewFloat(1)
+
+// realPow computes x**n, for x >= 0 and a non-integer n, at the precision
+// of x. It splits |n| into its integer part i and fraction f, so
+// x**|n| = x**i * x**f, and x**f is the product of the roots x**(1/2),
+// x**(1/4), ... selected by the bits of f. The work is done with guard bits,
+// more if x has a large exponent, since the error in the fraction is
+// magnified by log x.
+func realPow(x, n *big.Float) *big.Float {
+	switch {
+	case x.Sign() == 0 && n.Sign() < 0:
+		errorf("division by zero")
+	case x.Sign() == 0:
+		return new(big.Float).SetPrec(x.Prec())
+	}
+	exp := x.MantExp(nil)
+	prec := x.Prec() + 64 + uint(big.NewInt(int64(exp)).BitLen())
+	a := new(big.Float).SetPrec(prec).Abs(n)
+	i, _ := a.Int(nil)
+	f := new(big.Float).SetPrec(prec).Sub(a, new(big.Float).SetInt(i))
+	root := new(big.Float).SetPrec(prec).Set(x)
+	r := floatPow(root, i)
+	for f.Sign() > 0 {
+		root.Sqrt(root)
+		if root.Cmp(floatOne) == 0 {
+			break // The remaining roots are all 1 at this precision.
+		}
+		f.SetMantExp(f, 1)
+		if f.Cmp(floatOne) >= 0 {
+			r.Mul(r, root)
+			f.Sub(f, floatOne)
+		}
+	}
+	if n.Sign() < 0 {
+		r.Quo(floatOne, r)
+	}
+	return new(big.Float).SetPrec(x.Prec()).Set(r)
+}
+
+// (min x...) and (max x...) return the smallest and largest of their arguments.
+
+func (c *Context) minFunc(name *token, expr *Expr) *Expr { return c.extreme(name, expr, -1) }
+func (c *Context) maxFunc(name *token, expr *Expr) *Expr { return c.extreme(name, expr, +1) }
+
+// extreme returns the argument furthest in the direction of dir.
+func (c *Context) extreme(name *token, expr *Expr, dir int) *Expr {
+	if expr == nil {
+		errorf("%s of no arguments", name)
+	}
+	best := Car(expr)
+	c.getNumber(best)
+	for expr = Cdr(expr); expr != nil; expr = Cdr(expr) {
+		if numCmp(c.getNumber(Car(expr)), best.atom)*dir > 0 {
+			best = Car(expr)
+		}
+	}
+	return best
+}
+
+// (gcd x...) and (lcm x...) return the greatest common divisor and least
+// common multiple of the integers. The results are never negative.
+
+func (c *Context) gcdFunc(name *token, expr *Expr) *Expr {
+	g := new(big.Int)
+	for ; expr != nil; expr = Cdr(expr) {
+		g.GCD(nil, nil, g, c.getInteger(Car(expr)))
+	}
+	return atomExpr(number(g))
+}
+
+func (c *Context) lcmFunc(name *token, expr *Expr) *Expr {
+	l := big.NewInt(1)
+	for ; expr != nil; expr = Cdr(expr) {
+		x := c.getInteger(Car(expr))
+		if x.Sign() == 0 {
+			return atomExpr(number(new(big.Int)))
+		}
+		g := new(big.Int).GCD(nil, nil, l, x)
+		l.Abs(l.Mul(l, new(big.Int).Quo(x, g)))
+	}
+	return atomExpr(number(l))
+}
+
+// (sqrt x) returns the floating-point square root of x.
+func (c *Context) sqrtFunc(name *token, expr *Expr) *Expr {
+	t := c.getNumber(Car(expr))
+	if sign(t) < 0 {
+		errorf("sqrt of negative number %s", Car(expr))
+	}
+	return atomExpr(floatNumber(c.newFloat().Sqrt(c.toFloat(t))))
+}
+
+// (isqrt n) returns the integer square root of n, the largest integer
+// whose square is no greater than n.
+func (c *Context) isqrtFunc(name *token, expr *Expr) *Expr {
+	n := c.getInteger(Car(expr))
+	if n.Sign() < 0 {
+		errorf("isqrt of negative number %s", Car(expr))
+	}
+	return atomExpr(number(new(big.Int).Sqrt(n)))
+}
+
+// Bitwise operations on integers, which behave as if in two's complement.
+
+// logFunc applies fn to the integer arguments in turn, starting from init.
+func (c *Context) logFunc(expr *Expr, init int64, fn func(z, x, y *big.Int) *big.Int) *Expr {
+	z := big.NewInt(init)
+	for ; expr != nil; expr = Cdr(expr) {
+		fn(z, z, c.getInteger(Car(expr)))
+	}
+	return atomExpr(number(z))
+}
+
+func (c *Context) logandFunc(name *token, expr *Expr) *Expr {
+	return c.logFunc(expr, -1, (*big.Int).And)
+}
+
+func (c *Context) logorFunc(name *token, expr *Expr) *Expr {
+	return c.logFunc(expr, 0, (*big.Int).Or)
+}
+
+func (c *Context) logxorFunc(name *token, expr *Expr) *Expr {
+	return c.logFunc(expr, 0, (*big.Int).Xor)
+}
+
+// (leftshift x n) shifts x left n bits, or right if n is negative.
+func (c *Context) leftshiftFunc(name *token, expr *Expr) *Expr {
+	x, n := c.getInteger(Car(expr)), c.getInt(Car(Cdr(expr)))
+	if n < 0 {
+		return atomExpr(number(new(big.Int).Rsh(x, uint(-n))))
+	}
+	if x.Sign() != 0 && n > maxBits-x.BitLen() {
+		errorf("%s: result too large: %s shifted %d bits", name, x, n)
+	}
+	return atomExpr(number(new(big.Int).Lsh(x, uint(n))))
+}
+
+// Predicates.
+
+func (c *Context) numberpFunc(name *token, expr *Expr) *Expr {
+	return truthExpr(Car(expr).isNumber())
+}
+
+func (c *Context) zeropFunc(name *token, expr *Expr) *Expr {
+	return truthExpr(sign(c.getNumber(Car(expr))) == 0)
+}
+
+func (c *Context) minuspFunc(name *token, expr *Expr) *Expr {
+	return truthExpr(sign(c.getNumber(Car(expr))) < 0)
+}
+
+func (c *Context) onepFunc(name *token, expr *Expr) *Expr {
+	return truthExpr(numCmp(c.getNumber(Car(expr)), number(big.NewInt(1))) == 0)
+}
+
+func (c *Context) evenpFunc(name *token, expr *Expr) *Expr {
+	return truthExpr(c.getInteger(Car(expr)).Bit(0) == 0)
+}
+
+func (c *Context) oddpFunc(name *token, expr *Expr) *Expr {
+	return truthExpr(c.getInteger(Car(expr)).Bit(0) == 1)
+}
 
 // Logic. These are implemented here because they are variadic.
 
@@ -0,0 +1,93 @@
+// Copyright 2020 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// This file contains the operating system functions, which are available
+// only in a Context made with the OS option. Like the library functions,
+// they are found only if the atom has no value.
+
+package lisp1_5
+
+import (
+	"os"
+	"time"
+)
+
+var osLibrary funcMap
+
+func osInit() {
+	if osLibrary == nil {
+		osLibrary = funcMap{
+			tokArgs:    (*Context).argsFunc,
+			tokElapsed: (*Context).elapsedFunc,
+			tokExit:    (*Context).exitFunc,
+			tokGetenv:  (*Context).getenvFunc,
+			tokSleep:   (*Context).sleepFunc,
+			tokTime:    (*Context).timeFunc,
+		}
+	}
+}
+
+// OS returns an Option that makes the operating system functions
+// available: args, which returns the argument strings, getenv, exit,
+// time, elapsed, and sleep.
+func OS(args []string) Option {
+	return func(c *Context) {
+		c.osEnabled = true
+		c.args = args
+		c.start = time.Now()
+	}
+}
+
+// (args) returns the list of arguments, as strings.
+func (c *Context) argsFunc(name *token, expr *Expr) *Expr {
+	var result *Expr
+	for i := len(c.args) - 1; i >= 0; i-- {
+		result = Cons(stringExpr(c.args[i]), result)
+	}
+	return result
+}
+
+// (getenv s) returns the value of the environment variable s as a string,
+// or nil if it is not set.
+func (c *Context) getenvFunc(name *token, expr *Expr) *Expr {
+	value, ok := os.LookupEnv(getString(Car(expr)))
+	if !ok {
+		return nil
+	}
+	return stringExpr(value)
+}
+
+// (exit status) stops the program, with the status, default 0, which must
+// be between 0 and 255. It panics with an Exit, which the caller is expected
+// to handle.
+func (c *Context) exitFunc(name *token, expr *Expr) *Expr {
+	status := 0
+	if expr != nil {
+		status = c.getInt(Car(expr))
+	}
+	if status < 0 || status > 255 {
+		errorf("%s: status %d out of range", name, status)
+	}
+	panic(Exit(status))
+}
+
+// (time) returns the current time, in seconds since January 1, 1970 UTC.
+func (c *Context) timeFunc(name *token, expr *Expr) *Expr {
+	return intExpr(int(time.Now().Unix()))
+}
+
+// (elapsed) returns the time since the Context was made, in seconds.
+func (c *Context) elapsedFunc(name *token, expr *Expr) *Expr {
+	return atomExpr(floatNumber(c.newFloat().SetFloat64(time.Since(c.start).Seconds())))
+}
+
+// (sleep n) pauses for n seconds.
+func (c *Context) sleepFunc(name *token, expr *Expr) *Expr {
+	n, _ := c.toFloat(c.getNumber(Car(expr))).Float64()
+	if n < 0 {
+		errorf("%s: negative duration %s", name, Car(expr))
+	}
+	time.Sleep(time.Duration(n * float64(time.Second)))
+	return nil
+}
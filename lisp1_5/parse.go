@@ -31,18 +31,9 @@ type Expr struct {
 
 // SExprString returns the expression as a formatted S-Expression.
 func (e *Expr) SExprString() string {
-	if e == nil {
-		return "nil"
-	}
-	if e.atom != nil {
-		return e.atom.String()
-	}
-	str := "("
-	str += e.car.SExprString()
-	str += " . "
-	str += e.cdr.SExprString()
-	str += ")"
-	return str
+	var b strings.Builder
+	newPrinter(&b, e, true, false).print(e)
+	return b.String()
 }
 
 // String returns the expression as a formatted list (unless printSExpr is set).
@@ -50,56 +41,31 @@ func (e *Expr) String() string {
 	if printSExpr {
 		return e.SExprString()
 	}
-	if e == nil {
-		return "nil"
-	}
 	var b strings.Builder
 	e.buildString(&b, true)
 	return b.String()
 }
 
+// quotePrefix maps the atoms of the quoting forms to their short notation.
+var quotePrefix = map[*token]string{
+	tokQuote:           "'",
+	tokQuasiquote:      "`",
+	tokUnquote:         ",",
+	tokUnquoteSplicing: ",@",
+}
+
 // buildString is the internals of the String method. simplifyQuote
-// specifies whether (quote expr) should be printed as 'expr.
+// specifies whether (quote expr) should be printed as 'expr, and
+// similarly for backquote, comma, and comma-at.
 func (e *Expr) buildString(b *strings.Builder, simplifyQuote bool) {
-	if e == nil {
-		b.WriteString("nil")
-		return
-	}
-	if e.atom != nil {
-		e.atom.buildString(b)
-		return
-	}
-	// Simplify (quote a) to 'a.
-	if simplifyQuote && Car(e).getAtom() == tokQuote {
-		b.WriteByte('\'')
-		Car(Cdr(e)).buildString(b, simplifyQuote)
-		return
-	}
-	b.WriteByte('(')
-	for {
-		car, cdr := e.car, e.cdr
-		car.buildString(b, simplifyQuote)
-		if cdr == nil {
-			break
-		}
-		if cdr.atom != nil {
-			if cdr.atom.text == "nil" {
-				break
-			}
-			b.WriteString(" . ")
-			cdr.buildString(b, simplifyQuote)
-			break
-		}
-		b.WriteByte(' ')
-		e = cdr
-	}
-	b.WriteByte(')')
+	newPrinter(b, e, false, simplifyQuote).print(e)
 }
 
 // Parser is the parser for lists.
 type Parser struct {
 	lex     *lexer
 	peekTok *token
+	labels  map[string]*Expr // Expressions labeled #n=, indexed by n.
 }
 
 // NewParser returns a new parser that will read from the RuneReader.
@@ -108,6 +74,7 @@ func NewParser(r io.RuneReader) *Parser {
 	return &Parser{
 		lex:     newLexer(r),
 		peekTok: nil,
+		labels:  make(map[string]*Expr),
 	}
 }
 
@@ -137,26 +104,37 @@ func (p *Parser) back(tok *token) {
 	p.peekTok = tok
 }
 
+// SExpr parses an S-Expression. Labels defined by #n= within it
+// do not carry over to later expressions.
+func (p *Parser) SExpr() *Expr {
+	clear(p.labels)
+	return p.sExpr()
+}
+
 // sExpr parses an S-Expression.
 // SExpr:
 //	Atom
 //	Lpar SExpr Dot SExpr Rpar
-func (p *Parser) SExpr() *Expr {
+func (p *Parser) sExpr() *Expr {
 	tok := p.next()
 	switch tok.typ {
 	case tokenEOF:
 		return nil
-	case tokenQuote:
-		return p.quote()
-	case tokenAtom, tokenConst, tokenNumber:
-		return atomExpr(tok)
+	case tokenQuote, tokenBackquote, tokenComma, tokenCommaAt:
+		return p.quote(tok)
+	case tokenLabel:
+		return p.label(tok, p.sExpr)
+	case tokenLabelRef:
+		return p.labelRef(tok)
+	case tokenAtom, tokenConst, tokenNumber, tokenString:
+		return atom(tok)
 	case tokenLpar:
-		car := p.SExpr()
+		car := p.sExpr()
 		dot := p.next()
 		if dot.typ != tokenDot {
 			log.Fatal("expected dot, found ", dot)
 		}
-		cdr := p.SExpr()
+		cdr := p.sExpr()
 		rpar := p.next()
 		if rpar.typ != tokenRpar {
 			log.Fatal("expected rPar, found ", rpar)
@@ -167,21 +145,74 @@ func (p *Parser) SExpr() *Expr {
 	panic("not reached")
 }
 
-// quote parses a quoted expression. The leading quote has been consumed.
-func (p *Parser) quote() *Expr {
-	return Cons(atomExpr(tokQuote), Cons(p.List(), nil))
+// atom returns the expression for an atom read from the input.
+// The atom nil is the empty list.
+func atom(tok *token) *Expr {
+	if tok == tokNil {
+		return nil
+	}
+	return atomExpr(tok)
+}
+
+// quoteAtom maps the quoting tokens to the atoms of the forms they abbreviate.
+var quoteAtom = map[TokType]*token{
+	tokenQuote:     tokQuote,
+	tokenBackquote: tokQuasiquote,
+	tokenComma:     tokUnquote,
+	tokenCommaAt:   tokUnquoteSplicing,
+}
+
+// quote parses a quoted expression. The leading quote, which may
+// also be a backquote, comma, or comma-at, has been consumed.
+func (p *Parser) quote(tok *token) *Expr {
+	return Cons(atomExpr(quoteAtom[tok.typ]), Cons(p.list(), nil))
+}
+
+// label parses #n=expr, using the parse function to read the expression.
+// The #n= has been consumed. References to the label within the expression,
+// which make it circular, are to a placeholder that becomes the expression.
+// A label holds until it is redefined or the top-level expression ends.
+func (p *Parser) label(tok *token, parse func() *Expr) *Expr {
+	placeholder := new(Expr)
+	p.labels[tok.text] = placeholder
+	expr := parse()
+	if expr == nil || expr == placeholder {
+		errorf("bad labeled expression #%s=", tok.text)
+	}
+	*placeholder = *expr
+	return placeholder
+}
+
+// labelRef returns the expression labeled by the #n= matching tok, which is #n#.
+func (p *Parser) labelRef(tok *token) *Expr {
+	expr := p.labels[tok.text]
+	if expr == nil {
+		errorf("undefined label #%s#", tok.text)
+	}
+	return expr
 }
 
-// List parses a list expression.
+// List parses a list expression. Labels defined by #n= within it
+// do not carry over to later expressions.
 func (p *Parser) List() *Expr {
+	clear(p.labels)
+	return p.list()
+}
+
+// list parses a list expression.
+func (p *Parser) list() *Expr {
 	tok := p.next()
 	switch tok.typ {
 	case tokenEOF:
 		panic(EOF("eof"))
-	case tokenQuote:
-		return p.quote()
-	case tokenAtom, tokenConst, tokenNumber:
-		return atomExpr(tok)
+	case tokenQuote, tokenBackquote, tokenComma, tokenCommaAt:
+		return p.quote(tok)
+	case tokenLabel:
+		return p.label(tok, p.list)
+	case tokenLabelRef:
+		return p.labelRef(tok)
+	case tokenAtom, tokenConst, tokenNumber, tokenString:
+		return atom(tok)
 	case tokenLpar:
 		expr := p.lparList()
 		tok = p.next()
@@ -198,15 +229,15 @@ func (p *Parser) List() *Expr {
 func (p *Parser) lparList() *Expr {
 	tok := p.next()
 	switch tok.typ {
-	case tokenQuote:
-		return Cons(p.quote(), p.lparList())
-	case tokenAtom, tokenConst, tokenNumber:
-		return Cons(atomExpr(tok), p.lparList())
+	case tokenQuote, tokenBackquote, tokenComma, tokenCommaAt:
+		return Cons(p.quote(tok), p.lparList())
+	case tokenAtom, tokenConst, tokenNumber, tokenString:
+		return Cons(atom(tok), p.lparList())
 	case tokenDot:
-		return p.List()
-	case tokenLpar:
+		return p.list()
+	case tokenLpar, tokenLabel, tokenLabelRef:
 		p.back(tok)
-		return Cons(p.List(), p.lparList())
+		return Cons(p.list(), p.lparList())
 	case tokenRpar:
 		p.back(tok)
 		return nil
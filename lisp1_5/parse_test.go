@@ -25,6 +25,9 @@ var parseTests = []struct {
 	{"((a . (b . nil)) . (c . nil))", "((a b) c)"},
 	{"(a . (b . ((c . (d . nil)) . nil)))", "(a b (c d))"},
 	{"(a . ((b . c) . nil))", "(a (b . c))"},
+	{"(a . (nil . nil))", "(a nil)"},
+	{"(a-b . (-c . (d- . nil)))", "(a-b -c d-)"},
+	{"(macroexpand-1 . (- . (-1 . nil)))", "(macroexpand-1 - -1)"},
 }
 
 func TestSExprParse(t *testing.T) {
@@ -42,6 +45,23 @@ func TestSExprParse(t *testing.T) {
 	}
 }
 
+// The atom nil reads as the empty list, wherever it appears.
+func TestReadNil(t *testing.T) {
+	for _, s := range []string{"nil", "()", "'nil"} {
+		expr := NewParser(strings.NewReader(s)).List()
+		if s == "'nil" {
+			expr = Car(Cdr(expr))
+		}
+		if expr != nil {
+			t.Errorf("%q read as %s; expected empty list", s, expr.SExprString())
+		}
+	}
+	expr := NewParser(strings.NewReader("(a nil . nil)")).List()
+	if Car(Cdr(expr)) != nil || Cdr(Cdr(expr)) != nil {
+		t.Errorf("(a nil . nil) read as %s", expr.SExprString())
+	}
+}
+
 func TestListParse(t *testing.T) {
 	for _, test := range parseTests {
 		t.Log(test.l)
@@ -98,3 +118,61 @@ func TestParseQuote(t *testing.T) {
 		}
 	}
 }
+
+var parseBackquoteTests = []struct {
+	l         string
+	quoted    string
+	nonquoted string
+}{
+	{"`a", "`a", "(quasiquote a)"},
+	{"`(a ,b)", "`(a ,b)", "(quasiquote (a (unquote b)))"},
+	{"`(a ,@b c)", "`(a ,@b c)", "(quasiquote (a (unquote-splicing b) c))"},
+	{"`(a `(b ,,c))", "`(a `(b ,,c))", "(quasiquote (a (quasiquote (b (unquote (unquote c))))))"},
+}
+
+func TestParseBackquote(t *testing.T) {
+	for _, test := range parseBackquoteTests {
+		expr := NewParser(strings.NewReader(test.l)).List()
+		if str := expr.String(); str != test.quoted {
+			t.Errorf("%q.String() = %q, expected %q", test.l, str, test.quoted)
+		}
+		if str := expr.stringNoQuote(); str != test.nonquoted {
+			t.Errorf("%q.stringNoQuote() = %q, expected %q", test.l, str, test.nonquoted)
+		}
+	}
+}
+
+var parseLabelTests = []struct {
+	in  string
+	out string
+}{
+	{"#1=(a b . #1#)", "#1=(a b . #1#)"},
+	{"#1=(#1#)", "#1=(#1#)"},
+	{"(a . #1=(b c . #1#))", "(a . #1=(b c . #1#))"},
+	{"#1=(a #2=(b . #1#) . #2#)", "#1=(a #2=(b . #1#) . #2#)"},
+	// Labels need not make cycles.
+	{"(#1=(a b) #1#)", "(#1=(a b) #1#)"},
+}
+
+func TestParseLabel(t *testing.T) {
+	for _, test := range parseLabelTests {
+		expr := NewParser(strings.NewReader(test.in)).List()
+		if got := expr.String(); got != test.out {
+			t.Errorf("%s parsed as %s, expected %s", test.in, got, test.out)
+		}
+	}
+	// The label makes a real cycle.
+	expr := NewParser(strings.NewReader("#1=(a b . #1#)")).List()
+	if Cdr(Cdr(expr)) != expr {
+		t.Errorf("#1=(a b . #1#) is not circular")
+	}
+	// A label does not outlive the expression that defines it.
+	p := NewParser(strings.NewReader("#1=(a) #1#"))
+	p.List()
+	defer func() {
+		if _, ok := recover().(Error); !ok {
+			t.Error("label #1# defined in an earlier expression")
+		}
+	}()
+	p.List()
+}
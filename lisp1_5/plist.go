@@ -0,0 +1,111 @@
+// Copyright 2020 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// This file contains the definitions of the property list elementary
+// (builtin) functions. As in the Lisp 1.5 book, a property list
+// is a list of alternating indicators and values:
+//	(indicator value indicator value ...)
+// Property lists belong to the Context, so each interpreter has its own.
+
+package lisp1_5
+
+// getSymbol returns the atom represented by the expression, which
+// must be a symbol (a non-numeric atom).
+func getSymbol(expr *Expr) *token {
+	atom := expr.getAtom()
+	if atom == nil || atom.typ != tokenAtom && atom.typ != tokenConst {
+		errorf("expect symbol; have %s", expr)
+	}
+	return atom
+}
+
+// prop returns the cell of the property list of atom holding the indicator,
+// or nil if the indicator is not present.
+func (c *Context) prop(atom *token, ind *Expr) *Expr {
+	for p := c.plists[atom]; p != nil; p = Cdr(Cdr(p)) {
+		if eq(Car(p), ind) {
+			return p
+		}
+	}
+	return nil
+}
+
+// (get atom indicator) returns the value of the property, or nil.
+func (c *Context) getFunc(name *token, expr *Expr) *Expr {
+	return Car(Cdr(c.prop(getSymbol(Car(expr)), Car(Cdr(expr)))))
+}
+
+// (put atom indicator value) sets the value of the property.
+func (c *Context) putFunc(name *token, expr *Expr) *Expr {
+	atom := getSymbol(Car(expr))
+	ind := Car(Cdr(expr))
+	value := Car(Cdr(Cdr(expr)))
+	c.put(atom, ind, value)
+	return value
+}
+
+func (c *Context) put(atom *token, ind, value *Expr) {
+	if p := c.prop(atom, ind); p != nil && p.cdr != nil {
+		p.cdr.car = value
+		return
+	}
+	c.plists[atom] = Cons(ind, Cons(value, c.plists[atom]))
+}
+
+// (remprop atom indicator) removes the property, reporting whether it was present.
+func (c *Context) rempropFunc(name *token, expr *Expr) *Expr {
+	atom := getSymbol(Car(expr))
+	ind := Car(Cdr(expr))
+	var prev *Expr
+	for p := c.plists[atom]; p != nil; p = Cdr(Cdr(p)) {
+		if eq(Car(p), ind) {
+			if prev == nil {
+				c.plists[atom] = Cdr(Cdr(p))
+			} else {
+				prev.cdr.cdr = Cdr(Cdr(p))
+			}
+			return truthExpr(true)
+		}
+		prev = p
+	}
+	return truthExpr(false)
+}
+
+// (deflist ((atom value) ...) indicator) puts each value on its atom under
+// the indicator, and returns the list of atoms.
+func (c *Context) deflistFunc(name *token, expr *Expr) *Expr {
+	ind := Car(Cdr(expr))
+	var atoms []*Expr
+	for l := Car(expr); l != nil; l = Cdr(l) {
+		pair := Car(l)
+		c.put(getSymbol(Car(pair)), ind, Car(Cdr(pair)))
+		atoms = append(atoms, Car(pair))
+	}
+	var result *Expr
+	for i := len(atoms) - 1; i >= 0; i-- {
+		result = Cons(atoms[i], result)
+	}
+	return result
+}
+
+// (attrib atom list) appends the list to the end of the atom's property list.
+func (c *Context) attribFunc(name *token, expr *Expr) *Expr {
+	atom := getSymbol(Car(expr))
+	list := Car(Cdr(expr))
+	p := c.plists[atom]
+	if p == nil {
+		c.plists[atom] = list
+		return list
+	}
+	for p.cdr != nil {
+		p = p.cdr
+	}
+	p.cdr = list
+	return list
+}
+
+// (plist atom) returns the property list of the atom.
+func (c *Context) plistFunc(name *token, expr *Expr) *Expr {
+	return c.plists[getSymbol(Car(expr))]
+}
@@ -0,0 +1,95 @@
+; The prelude: the standard library, written in Lisp. It is embedded in
+; the interpreter and loaded into every new Context unless that is turned off.
+
+(defn(
+	; Nice examples.
+	(fac (lambda (n) (cond
+		((eq n 0) 1)
+		(T (mul n (fac (sub n 1))))
+	)))
+	(ack (λ (m n) (cond  ; Yes, you can use λ. It's prettier.
+		((eq m 0) (add n 1))
+		((eq n 0) (ack (sub m 1) 1))
+		(T (ack (sub m 1) (ack m (sub n 1))))
+	)))
+
+	; Helpers.
+	(not (λ (m) (cond
+		(m F)
+		(T T)
+	)))
+	(notnull (λ (x) (not (null x))))
+	(identity (λ (x) x))
+
+	; Demo of building a function.
+	(opN (λ (op N) `(λ (a) (,op ,N a))))
+
+	; From the book.
+	(union (λ (x y) (cond
+		((null x) y)
+		((member (car x) y) (union (cdr x) y))
+		(T (cons (car x) (union (cdr x) y)))
+	)))
+	(intersection (λ (x y) (cond
+		((null x) nil)
+		((member (car x) y) (cons (car x) (intersection (cdr x) y)))
+		(T (intersection (cdr x) y))
+	)))
+	(copy (λ (x) (cond
+		((atom x) x)
+		(T (cons (copy (car x)) (copy (cdr x))))
+	)))
+	; Efface deletes the first element of l equal to x.
+	(efface (λ (x l) (cond
+		((null l) nil)
+		((equal x (car l)) (cdr l))
+		(T (cons (car l) (efface x (cdr l))))
+	)))
+
+	; More list functions.
+	(set-difference (λ (x y) (cond
+		((null x) nil)
+		((member (car x) y) (set-difference (cdr x) y))
+		(T (cons (car x) (set-difference (cdr x) y)))
+	)))
+	; Remove deletes every element of l equal to x.
+	(remove (λ (x l) (cond
+		((null l) nil)
+		((equal x (car l)) (remove x (cdr l)))
+		(T (cons (car l) (remove x (cdr l))))
+	)))
+	(filter (λ (fn l) (cond
+		((null l) nil)
+		((fn (car l)) (cons (car l) (filter fn (cdr l))))
+		(T (filter fn (cdr l)))
+	)))
+	; (reduce fn l x) is (fn (fn (fn x l1) l2) l3) for the list (l1 l2 l3).
+	(reduce (λ (fn l x) (cond
+		((null l) x)
+		(T (reduce fn (cdr l) (fn x (car l))))
+	)))
+	; Iota returns the list (0 1 ... n-1).
+	(iota (λ (n) (prog (l)
+		loop	(cond ((le n 0) (return l)))
+			(setq n (sub n 1))
+			(setq l (cons n l))
+			(go loop)
+	)))
+	; Sort returns the elements of l ordered by less, a function of two arguments.
+	(sort (λ (l less) (cond
+		((null l) nil)
+		(T (insert (car l) (sort (cdr l) less) less))
+	)))
+	(insert (λ (x l less) (cond
+		((null l) (list x))
+		((less (car l) x) (cons (car l) (insert x (cdr l) less)))
+		(T (cons x l))
+	)))
+))
+
+; Macros.
+(defmacro let (bindings body)
+	`((λ ,(mapcar 'car bindings) ,body) ,@(mapcar 'cadr bindings)))
+(defmacro if (test then else) `(cond (,test ,then) (T ,else)))
+(defmacro when (test body) `(cond (,test ,body) (T nil)))
+(defmacro unless (test body) `(cond (,test nil) (T ,body)))
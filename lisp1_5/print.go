@@ -0,0 +1,198 @@
+// Copyright 2020 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+package lisp1_5
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A printer formats expressions. A cons or array that appears more than
+// once in the expression, whether because it is shared or because it closes
+// a cycle, is printed in full only the first time, labeled #n=, and thereafter
+// as the reference #n#, so circular structure prints in finite space and
+// shared structure shows as shared. The parser reads this notation back.
+type printer struct {
+	b             *strings.Builder
+	sexpr         bool         // Print dotted pairs only.
+	simplifyQuote bool         // Print (quote expr) as 'expr, etc.
+	princ         bool         // Print strings without quotes.
+	seen          map[any]bool // Objects reached so far by scan.
+	shared        map[any]int  // Label of each object reached more than once; 0 until printed.
+	label         int          // Last label assigned.
+}
+
+// newPrinter returns a printer for the expression, having found the
+// objects within it that need labels.
+func newPrinter(b *strings.Builder, e *Expr, sexpr, simplifyQuote bool) *printer {
+	p := &printer{
+		b:             b,
+		sexpr:         sexpr,
+		simplifyQuote: simplifyQuote,
+		seen:          make(map[any]bool),
+		shared:        make(map[any]int),
+	}
+	p.scan(e)
+	p.seen = nil
+	return p
+}
+
+// key returns the identity of a cons or array, or nil for other expressions,
+// which are never labeled.
+func key(e *Expr) any {
+	switch {
+	case e == nil:
+		return nil
+	case e.atom == nil:
+		return e
+	case e.atom.typ == tokenArray:
+		return e.atom.array
+	}
+	return nil
+}
+
+// scan records in p.shared the objects that are reached more than once.
+// It iterates along the cdr so long lists do not recur deeply.
+func (p *printer) scan(e *Expr) {
+	for e != nil {
+		if e.atom != nil && e.atom.typ == tokenFunarg {
+			p.scan(e.atom.funarg.fn)
+			return
+		}
+		k := key(e)
+		if k == nil {
+			return
+		}
+		if p.seen[k] {
+			p.shared[k] = 0
+			return
+		}
+		p.seen[k] = true
+		if e.atom != nil {
+			for _, elem := range e.atom.array.elems {
+				p.scan(elem)
+			}
+			return
+		}
+		p.scan(e.car)
+		e = e.cdr
+	}
+}
+
+// isShared reports whether the expression needs a label.
+func (p *printer) isShared(e *Expr) bool {
+	_, ok := p.shared[key(e)]
+	return ok
+}
+
+// mark prints the label of a shared object: #n# if the object has been
+// printed already, in which case it returns true, or #n= before the
+// object is printed the first time.
+func (p *printer) mark(e *Expr) bool {
+	k := key(e)
+	n, ok := p.shared[k]
+	switch {
+	case !ok:
+		return false
+	case n > 0:
+		fmt.Fprintf(p.b, "#%d#", n)
+		return true
+	}
+	p.label++
+	p.shared[k] = p.label
+	fmt.Fprintf(p.b, "#%d=", p.label)
+	return false
+}
+
+func (p *printer) print(e *Expr) {
+	if e == nil {
+		p.b.WriteString("nil")
+		return
+	}
+	if p.mark(e) {
+		return
+	}
+	if e.atom != nil {
+		p.atom(e.atom)
+		return
+	}
+	if p.sexpr {
+		p.b.WriteByte('(')
+		p.print(e.car)
+		p.b.WriteString(" . ")
+		p.print(e.cdr)
+		p.b.WriteByte(')')
+		return
+	}
+	// Simplify (quote a) to 'a, etc.
+	if prefix, ok := quotePrefix[Car(e).getAtom()]; ok && p.simplifyQuote && Cdr(e) != nil && Cdr(Cdr(e)) == nil && !p.isShared(Cdr(e)) {
+		p.b.WriteString(prefix)
+		p.print(Car(Cdr(e)))
+		return
+	}
+	p.b.WriteByte('(')
+	for {
+		car, cdr := e.car, e.cdr
+		p.print(car)
+		if cdr == nil {
+			break
+		}
+		if cdr.atom != nil || p.isShared(cdr) {
+			if cdr.atom == tokNil {
+				break
+			}
+			p.b.WriteString(" . ")
+			p.print(cdr)
+			break
+		}
+		p.b.WriteByte(' ')
+		e = cdr
+	}
+	p.b.WriteByte(')')
+}
+
+func (p *printer) atom(t *token) {
+	switch t.typ {
+	case tokenArray:
+		p.array(t.array.dims, t.array.elems)
+	case tokenFunarg:
+		if t.funarg.fn == nil {
+			p.b.WriteString("#<env>")
+			break
+		}
+		p.b.WriteString("#<funarg ")
+		p.print(t.funarg.fn)
+		p.b.WriteByte('>')
+	case tokenString:
+		if p.princ {
+			p.b.WriteString(t.text)
+			break
+		}
+		p.b.WriteString(t.String())
+	default:
+		p.b.WriteString(t.String())
+	}
+}
+
+// array prints the elements as #(elem ...), with a nested #(...)
+// for each row of a multi-dimensional array.
+func (p *printer) array(dims []int, elems []*Expr) {
+	p.b.WriteString("#(")
+	stride := len(elems)
+	if dims[0] > 0 {
+		stride /= dims[0]
+	}
+	for i := 0; i < dims[0]; i++ {
+		if i > 0 {
+			p.b.WriteByte(' ')
+		}
+		if len(dims) == 1 {
+			p.print(elems[i])
+		} else {
+			p.array(dims[1:], elems[i*stride:(i+1)*stride])
+		}
+	}
+	p.b.WriteByte(')')
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// This file contains the implementation of file streams and their
+// elementary (builtin) functions. A stream is opened by
+//
+//	(open file direction)
+//
+// where direction is input (the default), output, or append. Functions
+// that take an optional stream use the context's input or output if
+// it is missing or nil. Input streams are read through a Parser, so read
+// on a stream parses expressions exactly as the interpreter does.
+
+package lisp1_5
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A stream is an open file.
+type stream struct {
+	name   string   // The file name, for printing.
+	file   *os.File // The underlying file.
+	parser *Parser  // The parser for input; nil for output streams.
+	closed bool     // Whether the stream has been closed.
+}
+
+func (s *stream) String() string {
+	dir := "output"
+	if s.parser != nil {
+		dir = "input"
+	}
+	if s.closed {
+		dir = "closed"
+	}
+	return fmt.Sprintf("#<stream %s %s>", dir, s.name)
+}
+
+// openStream opens the file in the direction named by the atom dir,
+// which is nil for input.
+func (c *Context) openStream(name *token, file string, dir *Expr) *Expr {
+	var flag int
+	switch dir.getAtom() {
+	case nil, tokInput:
+		flag = os.O_RDONLY
+	case tokOutput:
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	case tokAppend:
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	default:
+		errorf("%s: unknown direction %s", name, dir)
+	}
+	f, err := os.OpenFile(file, flag, 0666)
+	if err != nil {
+		errorf("%s: %v", name, err)
+	}
+	s := &stream{name: file, file: f}
+	if flag == os.O_RDONLY {
+		s.parser = c.newParser(bufio.NewReader(f))
+	}
+	return atomExpr(&token{typ: tokenStream, stream: s})
+}
+
+// close closes the stream and returns any error from closing the file.
+// Closing a closed stream does nothing.
+func (s *stream) close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.file.Close()
+}
+
+// getStream returns the open stream represented by the expression.
+func getStream(name *token, expr *Expr) *stream {
+	atom := expr.getAtom()
+	if atom == nil || atom.typ != tokenStream {
+		errorf("%s: expect stream; have %s", name, expr)
+	}
+	if atom.stream.closed {
+		errorf("%s: %s is closed", name, expr)
+	}
+	return atom.stream
+}
+
+// inputParser returns the parser for the input stream represented by the
+// expression, or for the context's input if the expression is nil.
+func (c *Context) inputParser(name *token, expr *Expr) *Parser {
+	if expr == nil {
+		return c.parser()
+	}
+	s := getStream(name, expr)
+	if s.parser == nil {
+		errorf("%s: %s is not an input stream", name, expr)
+	}
+	return s.parser
+}
+
+// writer returns the output stream represented by the expression,
+// or the context's output if the expression is nil.
+func (c *Context) writer(name *token, expr *Expr) io.Writer {
+	if expr == nil {
+		return c.output
+	}
+	s := getStream(name, expr)
+	if s.parser != nil {
+		errorf("%s: %s is not an output stream", name, expr)
+	}
+	return s.file
+}
+
+// eof returns the value of a read function at end of file: the optional
+// eof value, which follows the stream in the argument list, if present.
+func eof(name *token, expr *Expr) *Expr {
+	if Cdr(expr) == nil {
+		errorf("%s: end of file", name)
+	}
+	return Car(Cdr(expr))
+}
+
+// readLine returns the rest of the current line, without the newline.
+// The boolean is false at end of file.
+func (p *Parser) readLine() (string, bool) {
+	var b strings.Builder
+	for {
+		switch r := p.lex.read(); r {
+		case EofRune:
+			return b.String(), b.Len() > 0
+		case '\n':
+			return b.String(), true
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+// (open file direction) opens the named file for input, output, or append.
+func (c *Context) openFunc(name *token, expr *Expr) *Expr {
+	return c.openStream(name, getString(Car(expr)), Car(Cdr(expr)))
+}
+
+// (close stream) closes the stream.
+func (c *Context) closeFunc(name *token, expr *Expr) *Expr {
+	atom := Car(expr).getAtom()
+	if atom == nil || atom.typ != tokenStream {
+		errorf("%s: expect stream; have %s", name, Car(expr))
+	}
+	if err := atom.stream.close(); err != nil {
+		errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// (streamp x) reports whether x is a stream.
+func (c *Context) streampFunc(name *token, expr *Expr) *Expr {
+	atom := Car(expr).getAtom()
+	return truthExpr(atom != nil && atom.typ == tokenStream)
+}
+
+// (read-line stream eof) returns the next line of the stream as a string.
+func (c *Context) readLineFunc(name *token, expr *Expr) *Expr {
+	line, ok := c.inputParser(name, Car(expr)).readLine()
+	if !ok {
+		return eof(name, expr)
+	}
+	return stringExpr(line)
+}
+
+// (read-char stream eof) returns the next character of the stream,
+// as a single-character atom.
+func (c *Context) readCharFunc(name *token, expr *Expr) *Expr {
+	r := c.inputParser(name, Car(expr)).lex.read()
+	if r == EofRune {
+		return eof(name, expr)
+	}
+	return charExpr(r)
+}
+
+// (write-string s stream) writes the string s to the stream, and returns s.
+func (c *Context) writeStringFunc(name *token, expr *Expr) *Expr {
+	s := Car(expr)
+	c.write(name, Car(Cdr(expr)), getString(s))
+	return s
+}
+
+// withOpenFile evaluates (with-open-file (var file direction) body ...),
+// which binds var to the stream (open file direction) while it evaluates
+// the body, and returns the value of the last expression. The stream is
+// closed however the body finishes, including by error. An error closing
+// the file is reported only if the body succeeded, so it cannot hide an
+// error from the body.
+func (c *Context) withOpenFile(x *Expr) *Expr {
+	spec := Car(x)
+	atom := Car(spec).getAtom()
+	if atom == nil {
+		errorf("with-open-file: %s is not an atom", Car(spec))
+	}
+	file := getString(c.eval(Car(Cdr(spec))))
+	s := c.openStream(tokWithOpenFile, file, c.eval(Car(Cdr(Cdr(spec)))))
+	stream := s.atom.stream
+	defer stream.close() // For errors; the error from close is dropped.
+	c.push("with-open-file", Cons(Car(spec), nil))
+	c.setLocal(atom, s)
+	var result *Expr
+	for body := Cdr(x); body != nil; body = Cdr(body) {
+		result = c.eval(Car(body))
+	}
+	c.pop()
+	if err := stream.close(); err != nil {
+		errorf("with-open-file: %v", err)
+	}
+	return result
+}
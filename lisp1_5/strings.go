@@ -0,0 +1,203 @@
+// Copyright 2020 Rob Pike. All rights reserved.
+// Use of this source code is governed by a BSD
+// license that can be found in the LICENSE file.
+
+// This file contains the definitions of the string and character
+// elementary (builtin) functions. Strings are atoms that evaluate to
+// themselves. Indexes count characters (runes), not bytes, starting at 0.
+
+package lisp1_5
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// getString returns the value of the expression, which must be a string.
+func getString(expr *Expr) string {
+	atom := expr.getAtom()
+	if atom == nil || atom.typ != tokenString {
+		errorf("expect string; have %s", expr)
+	}
+	return atom.text
+}
+
+func stringExpr(s string) *Expr {
+	return atomExpr(mkString(s))
+}
+
+// (stringp x) reports whether x is a string.
+func (c *Context) stringpFunc(name *token, expr *Expr) *Expr {
+	atom := Car(expr).getAtom()
+	return truthExpr(atom != nil && atom.typ == tokenString)
+}
+
+// (string-length s) returns the number of characters in s.
+func (c *Context) stringLengthFunc(name *token, expr *Expr) *Expr {
+	return intExpr(utf8.RuneCountInString(getString(Car(expr))))
+}
+
+// (concat s...) returns the concatenation of the strings.
+func (c *Context) concatFunc(name *token, expr *Expr) *Expr {
+	var b strings.Builder
+	for ; expr != nil; expr = Cdr(expr) {
+		b.WriteString(getString(Car(expr)))
+	}
+	return stringExpr(b.String())
+}
+
+// (substring s start [end]) returns the characters of s from start
+// up to but not including end, which defaults to the length of s.
+func (c *Context) substringFunc(name *token, expr *Expr) *Expr {
+	r := []rune(getString(Car(expr)))
+	start, end := c.getInt(Car(Cdr(expr))), len(r)
+	if e := Cdr(Cdr(expr)); e != nil {
+		end = c.getInt(Car(e))
+	}
+	if start < 0 || end < start || len(r) < end {
+		errorf("substring %d %d out of range for %s", start, end, Car(expr))
+	}
+	return stringExpr(string(r[start:end]))
+}
+
+// (string-index s sub) returns the index of the first instance of sub in s,
+// or -1 if it is not present.
+func (c *Context) stringIndexFunc(name *token, expr *Expr) *Expr {
+	s := getString(Car(expr))
+	i := strings.Index(s, getString(Car(Cdr(expr))))
+	if i > 0 {
+		i = utf8.RuneCountInString(s[:i])
+	}
+	return intExpr(i)
+}
+
+func (c *Context) stringUpcaseFunc(name *token, expr *Expr) *Expr {
+	return stringExpr(strings.ToUpper(getString(Car(expr))))
+}
+
+func (c *Context) stringDowncaseFunc(name *token, expr *Expr) *Expr {
+	return stringExpr(strings.ToLower(getString(Car(expr))))
+}
+
+func (c *Context) stringEqFunc(name *token, expr *Expr) *Expr {
+	return truthExpr(getString(Car(expr)) == getString(Car(Cdr(expr))))
+}
+
+func (c *Context) stringLtFunc(name *token, expr *Expr) *Expr {
+	return truthExpr(getString(Car(expr)) < getString(Car(Cdr(expr))))
+}
+
+// Conversions.
+
+func (c *Context) stringToSymbolFunc(name *token, expr *Expr) *Expr {
+	s := getString(Car(expr))
+	if s == "" {
+		errorf("empty symbol name")
+	}
+	return atom(mkAtom(s))
+}
+
+func (c *Context) symbolToStringFunc(name *token, expr *Expr) *Expr {
+	if Car(expr) == nil {
+		return stringExpr(tokNil.text)
+	}
+	return stringExpr(getSymbol(Car(expr)).text)
+}
+
+// (string-to-number s) returns the number written in s, or nil if s
+// does not hold a number.
+func (c *Context) stringToNumberFunc(name *token, expr *Expr) *Expr {
+	if tok := c.parseNumber(getString(Car(expr))); tok != nil {
+		return atomExpr(tok)
+	}
+	return nil
+}
+
+func (c *Context) numberToStringFunc(name *token, expr *Expr) *Expr {
+	return stringExpr(c.getNumber(Car(expr)).String())
+}
+
+// parseNumber returns the number represented by the text, or nil if
+// the text is not a number.
+func (c *Context) parseNumber(text string) (tok *token) {
+	defer func() {
+		if e := recover(); e != nil {
+			if _, ok := e.(Error); !ok {
+				panic(e)
+			}
+			tok = nil
+		}
+	}()
+	l := c.newParser(strings.NewReader(text)).lex
+	tok = l.next()
+	if tok.typ != tokenNumber || l.next().typ != tokenEOF {
+		return nil
+	}
+	return tok
+}
+
+// Characters. As in chapter 6 of the Lisp 1.5 book, a character is an atom
+// whose print name is a single character. Digits are the numbers 0 to 9.
+
+// printName returns the text of an atom, which may be a number or string.
+func printName(expr *Expr) string {
+	if expr == nil {
+		return tokNil.text
+	}
+	atom := expr.getAtom()
+	switch {
+	case atom == nil:
+		errorf("expect atom; have %s", expr)
+	case atom.typ == tokenNumber:
+		return atom.String()
+	}
+	return atom.text
+}
+
+// (explode x) returns the list of the characters of the print name of
+// the atom x. Unpack is a synonym.
+func (c *Context) explodeFunc(name *token, expr *Expr) *Expr {
+	var result *Expr
+	r := []rune(printName(Car(expr)))
+	for i := len(r) - 1; i >= 0; i-- {
+		result = Cons(charExpr(r[i]), result)
+	}
+	return result
+}
+
+func charExpr(r rune) *Expr {
+	if isNumber(r) {
+		return intExpr(int(r - '0'))
+	}
+	return atomExpr(mkAtom(string(r)))
+}
+
+// (implode l) returns the atom whose print name is the concatenation of
+// the print names of the atoms in the list l. If that is a number, the
+// result is the number. Pack is a synonym.
+func (c *Context) implodeFunc(name *token, expr *Expr) *Expr {
+	var b strings.Builder
+	for l := Car(expr); l != nil; l = Cdr(l) {
+		b.WriteString(printName(Car(l)))
+	}
+	if b.Len() == 0 {
+		errorf("%s of empty list", name)
+	}
+	if tok := c.parseNumber(b.String()); tok != nil {
+		return atomExpr(tok)
+	}
+	return atom(mkAtom(b.String()))
+}
+
+// (gensym [prefix]) returns a new atom that is distinct from every other
+// atom, even one with the same print name, because it is not interned.
+// The print name is the prefix, by default g, followed by a number.
+func (c *Context) gensymFunc(name *token, expr *Expr) *Expr {
+	prefix := "g"
+	if expr != nil {
+		prefix = printName(Car(expr))
+	}
+	c.gensymCount++
+	return atomExpr(&token{typ: tokenAtom, text: fmt.Sprintf("%s%d", prefix, c.gensymCount), num: &zero})
+}
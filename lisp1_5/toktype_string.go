@@ -19,11 +19,21 @@ func _() {
 	_ = x[tokenChar-8]
 	_ = x[tokenQuote-9]
 	_ = x[tokenNewline-10]
+	_ = x[tokenFunarg-11]
+	_ = x[tokenBackquote-12]
+	_ = x[tokenComma-13]
+	_ = x[tokenCommaAt-14]
+	_ = x[tokenString-15]
+	_ = x[tokenArray-16]
+	_ = x[tokenHash-17]
+	_ = x[tokenStream-18]
+	_ = x[tokenLabel-19]
+	_ = x[tokenLabelRef-20]
 }
 
-const _TokType_name = "tokenErrortokenEOFtokenAtomtokenConsttokenNumbertokenLpartokenRpartokenDottokenChartokenQuotetokenNewline"
+const _TokType_name = "tokenErrortokenEOFtokenAtomtokenConsttokenNumbertokenLpartokenRpartokenDottokenChartokenQuotetokenNewlinetokenFunargtokenBackquotetokenCommatokenCommaAttokenStringtokenArraytokenHashtokenStreamtokenLabeltokenLabelRef"
 
-var _TokType_index = [...]uint8{0, 10, 18, 27, 37, 48, 57, 66, 74, 83, 93, 105}
+var _TokType_index = [...]uint8{0, 10, 18, 27, 37, 48, 57, 66, 74, 83, 93, 105, 116, 130, 140, 152, 163, 173, 182, 193, 203, 216}
 
 func (i TokType) String() string {
 	if i < 0 || i >= TokType(len(_TokType_index)-1) {
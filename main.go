@@ -14,17 +14,6 @@
 // or even realistic Lisp implementation. The goal was to turn that marvelous page
 // 13 into a working interpreter using clean, direct Go code.
 //
-// The program therefore has several profound shortcomings, even with respect to
-// the Lisp 1.5 book:
-//
-//  - No `SET` or `SETQ`.
-//  - No `PROG`. The interpreter, by calling `APPLY`, can evaluate only a single
-//    expression, a possibly recursive function invocation. But this is Lisp, and
-//    that's still a lot.
-//  - No character handling.
-//  - No I/O. Interactive only, although it can start by reading a file specified
-//    on the command line.
-//
 // It is slow and of course the language is very, very far from Common Lisp or
 // Scheme.
 package main // import "robpike.io/lisp"
@@ -34,6 +23,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"robpike.io/lisp/lisp1_5"
 )
@@ -43,26 +33,64 @@ var (
 	doPrompt   = flag.Bool("doprompt", true, "show interactive prompt")
 	prompt     = flag.String("prompt", "> ", "interactive prompt")
 	stackDepth = flag.Int("depth", 1e5, "maximum call depth; 0 means no limit")
+	macroCache = flag.Bool("macrocache", false, "cache macro expansions")
+	aList      = flag.Bool("alist", false, "use the a-list evaluator of the Lisp 1.5 book")
+	evalQuote  = flag.Bool("evalquote", false, "read standard input as EVALQUOTE pairs: a function and a list of its arguments")
+	floatPrec  = flag.Uint("prec", 53, "precision in bits of floating-point numbers")
+	libPath    = flag.String("libpath", ".", "list of directories to search for modules")
+	noPrelude  = flag.Bool("noprelude", false, "do not load the prelude, the standard library")
 )
 
+// status is the exit status, which becomes 1 once there has been an error.
+var status int
+
 var loading bool
 
 func main() {
 	flag.Parse()
 	lisp1_5.Config(*printSExpr)
-	context := lisp1_5.NewContext(*stackDepth)
+	// The interpreter and the read builtin share standard input.
+	parser := lisp1_5.NewParser(bufio.NewReader(os.Stdin))
+	context := lisp1_5.NewContext(*stackDepth,
+		lisp1_5.FloatPrecision(*floatPrec),
+		lisp1_5.MacroCache(*macroCache),
+		lisp1_5.AList(*aList),
+		lisp1_5.Input(parser),
+		lisp1_5.LibraryPath(filepath.SplitList(*libPath)),
+		lisp1_5.Prelude(!*noPrelude),
+		lisp1_5.OS(args()))
 	loading = true
-	for _, file := range flag.Args() {
+	for _, file := range files() {
 		load(context, file)
 	}
 	loading = false
-	parser := lisp1_5.NewParser(bufio.NewReader(os.Stdin))
 	for {
 		input(context, parser, *prompt)
 	}
 }
 
-// load reads the named source file and parses it within the context.
+// files returns the names of the files to load, which are the arguments
+// before the separator "--", if any.
+func files() []string {
+	for i, arg := range flag.Args() {
+		if arg == "--" {
+			return flag.Args()[:i]
+		}
+	}
+	return flag.Args()
+}
+
+// args returns the arguments for the script, which follow the separator "--".
+func args() []string {
+	n := len(files())
+	if n == flag.NArg() {
+		return nil
+	}
+	return flag.Args()[n+1:]
+}
+
+// load reads the named source file and parses it within the context,
+// printing the value of each expression as the interactive interpreter does.
 func load(context *lisp1_5.Context, file string) {
 	fd, err := os.Open(file)
 	if err != nil {
@@ -86,11 +114,17 @@ func input(context *lisp1_5.Context, parser *lisp1_5.Parser, prompt string) {
 			continue
 		case lisp1_5.EofRune:
 			if !loading {
-				os.Exit(0)
+				os.Exit(status)
 			}
 			return
 		}
-		expr := context.Eval(parser.List())
+		var expr *lisp1_5.Expr
+		if *evalQuote && !loading {
+			fn := parser.List()
+			expr = context.EvalQuote(fn, parser.List())
+		} else {
+			expr = context.Eval(parser.List())
+		}
 		fmt.Println(expr)
 		parser.SkipSpace() // Grab the newline.
 	}
@@ -103,8 +137,11 @@ func handler(context *lisp1_5.Context, parser *lisp1_5.Parser) {
 	if e != nil {
 		switch e := e.(type) {
 		case lisp1_5.EOF:
-			os.Exit(0)
+			os.Exit(status)
+		case lisp1_5.Exit:
+			os.Exit(int(e))
 		case lisp1_5.Error:
+			status = 1
 			fmt.Fprintln(os.Stderr, e)
 			parser.SkipToEndOfLine()
 			fmt.Fprint(os.Stderr, context.StackTrace())